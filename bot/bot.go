@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/config"
+	"qq_bot/connection"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"sync"
+	"time"
+)
+
+// Bot 单个QQ账号的运行实例
+type Bot struct {
+	SelfID     int64
+	Config     *config.AccountConfig
+	Conn       connection.Connection
+	API        *protocol.API
+	Dispatcher *event.Dispatcher
+}
+
+// ConnectionFactory 连接创建函数（回放等场景替换真实连接）
+type ConnectionFactory func(cfg *config.AccountConfig, handler func(*protocol.Event)) (connection.Connection, error)
+
+// Manager 多账号管理器，按Event.SelfID路由事件
+type Manager struct {
+	bots     []*Bot
+	bySelfID map[int64]*Bot
+	pool     *event.Pool
+	newConn  ConnectionFactory
+	recorder *connection.Recorder
+	timeout  time.Duration
+	ctx      context.Context // 根上下文，Stop时取消
+	cancel   context.CancelFunc
+	mu       sync.RWMutex
+}
+
+// NewManager 创建多账号管理器
+func NewManager(dispatchCfg *config.DispatchConfig) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var timeout time.Duration
+	if dispatchCfg != nil {
+		timeout = time.Duration(dispatchCfg.Timeout) * time.Second
+	}
+
+	return &Manager{
+		bots:     make([]*Bot, 0),
+		bySelfID: make(map[int64]*Bot),
+		pool:     event.NewPool(dispatchCfg),
+		timeout:  timeout,
+		ctx:      event.WithRoot(ctx),
+		cancel:   cancel,
+		newConn: func(cfg *config.AccountConfig, handler func(*protocol.Event)) (connection.Connection, error) {
+			return connection.New(cfg.NapCat, handler)
+		},
+	}
+}
+
+// SetConnectionFactory 替换连接创建函数，需在Add之前调用
+func (m *Manager) SetConnectionFactory(factory ConnectionFactory) {
+	m.newConn = factory
+}
+
+// SetRecorder 设置流量录制器，需在Add之前调用
+func (m *Manager) SetRecorder(recorder *connection.Recorder) {
+	m.recorder = recorder
+}
+
+// Add 根据账号配置创建机器人实例（连接、API、事件分发器）
+func (m *Manager) Add(cfg *config.AccountConfig) (*Bot, error) {
+	if cfg.NapCat == nil {
+		return nil, fmt.Errorf("账号 %d 缺少napcat配置", cfg.SelfID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.bySelfID[cfg.SelfID]; exists {
+		return nil, fmt.Errorf("账号 %d 重复配置", cfg.SelfID)
+	}
+
+	b := &Bot{
+		SelfID:     cfg.SelfID,
+		Config:     cfg,
+		Dispatcher: event.NewDispatcher(),
+	}
+	b.Dispatcher.SetTimeout(m.timeout)
+
+	conn, err := m.newConn(cfg, func(e *protocol.Event) {
+		m.route(b, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn.SetRecorder(m.recorder)
+
+	b.Conn = conn
+	b.API = protocol.NewAPI(conn.SendMessage)
+	b.API.SetMessageFormat(cfg.NapCat.MessageFormat)
+	conn.SetResponseHandler(b.API.HandleResponse)
+	conn.OnStateChange(b.handleStateChange)
+
+	m.bots = append(m.bots, b)
+	m.bySelfID[cfg.SelfID] = b
+	return b, nil
+}
+
+// Get 根据机器人QQ号获取实例
+func (m *Manager) Get(selfID int64) *Bot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.bySelfID[selfID]
+}
+
+// Bots 获取全部机器人实例
+func (m *Manager) Bots() []*Bot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Bot(nil), m.bots...)
+}
+
+// route 将事件路由到Event.SelfID对应的机器人，未知账号交给接收连接所属的机器人
+// 事件先交给等待中的会话，否则进入处理池，同一会话串行处理
+func (m *Manager) route(owner *Bot, e *protocol.Event) {
+	target := owner
+	if e.SelfID != 0 && e.SelfID != owner.SelfID {
+		if b := m.Get(e.SelfID); b != nil {
+			target = b
+		} else {
+			utils.Debug("收到未配置账号的事件: self_id=%d, 由账号 %d 处理", e.SelfID, owner.SelfID)
+		}
+	}
+	// 等待中的会话（如确认提示）优先接收，不进入处理池
+	if target.Dispatcher.Intercept(e) {
+		return
+	}
+	accepted := m.pool.Submit(event.SessionKey(e), func() {
+		target.Dispatcher.Dispatch(m.ctx, e)
+	})
+	if !accepted {
+		target.Dispatcher.Untrack(e)
+	}
+}
+
+// Start 启动所有账号的连接
+func (m *Manager) Start() error {
+	for _, b := range m.Bots() {
+		if err := b.Conn.Start(); err != nil {
+			return fmt.Errorf("账号 %d 启动失败: %v", b.SelfID, err)
+		}
+	}
+	return nil
+}
+
+// Context 根上下文，Stop时取消（供处理函数之外的后台任务使用）
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Wait 等待已提交的事件处理完成（不取消处理中的事件）
+func (m *Manager) Wait() {
+	m.pool.Wait()
+}
+
+// Stop 停止所有账号的连接，取消处理中的事件并等待其退出
+func (m *Manager) Stop() {
+	for _, b := range m.Bots() {
+		if err := b.Conn.Stop(); err != nil {
+			utils.Error("账号 %d 关闭连接失败: %v", b.SelfID, err)
+		}
+	}
+	m.cancel()
+	m.pool.Stop()
+}
+
+// OnStateChange 订阅该账号的连接状态变更
+func (b *Bot) OnStateChange(listener connection.StateListener) {
+	b.Conn.OnStateChange(listener)
+}
+
+// Health 获取该账号的连接健康状态
+func (b *Bot) Health() connection.Health {
+	return b.Conn.Health()
+}
+
+// handleStateChange 连接状态变更处理
+func (b *Bot) handleStateChange(oldState, newState connection.State) {
+	utils.Info("账号 %d 连接状态: %s -> %s", b.SelfID, oldState, newState)
+	if newState == connection.StateConnected {
+		go b.checkLogin()
+	}
+}
+
+// checkLogin 获取登录号信息并核对配置的QQ号
+func (b *Bot) checkLogin() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := b.API.GetLoginInfo(ctx)
+	if err != nil {
+		utils.Error("账号 %d 获取登录信息失败: %v", b.SelfID, err)
+		return
+	}
+
+	utils.Info("当前登录账号: %s(%d)", info.Nickname, info.UserID)
+	if b.SelfID != 0 && info.UserID != b.SelfID {
+		utils.Error("登录账号 %d 与配置的self_id %d 不一致", info.UserID, b.SelfID)
+	}
+
+	// 识别OneBot实现，NapCat时启用扩展动作
+	version, err := b.API.DetectCapabilities(ctx)
+	if err != nil {
+		utils.Error("账号 %d 获取版本信息失败: %v", b.SelfID, err)
+		return
+	}
+	utils.Info("OneBot实现: %s %s, NapCat扩展: %v", version.AppName, version.AppVersion, b.API.IsNapCat())
+}
@@ -0,0 +1,226 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"strconv"
+	"strings"
+)
+
+// Level 权限等级
+type Level int
+
+const (
+	LevelUser    Level = iota // 普通用户
+	LevelTrusted              // 信任用户
+	LevelAdmin                // 管理员
+	LevelOwner                // 主人
+)
+
+// String 权限等级名称
+func (l Level) String() string {
+	switch l {
+	case LevelTrusted:
+		return "信任用户"
+	case LevelAdmin:
+		return "管理员"
+	case LevelOwner:
+		return "主人"
+	default:
+		return "所有人"
+	}
+}
+
+// Scope 命令可用范围
+type Scope int
+
+const (
+	ScopePrivate Scope = 1 << iota // 私聊
+	ScopeGroup                     // 群聊
+	ScopeAll     = ScopePrivate | ScopeGroup
+)
+
+// String 范围名称
+func (s Scope) String() string {
+	switch s {
+	case ScopePrivate:
+		return "仅私聊"
+	case ScopeGroup:
+		return "仅群聊"
+	default:
+		return "私聊和群聊"
+	}
+}
+
+// allows 判断消息类型是否在范围内（未设置视为全部）
+func (s Scope) allows(messageType string) bool {
+	if s == 0 {
+		s = ScopeAll
+	}
+	switch messageType {
+	case "private":
+		return s&ScopePrivate != 0
+	case "group":
+		return s&ScopeGroup != 0
+	}
+	return false
+}
+
+// ArgType 参数类型
+type ArgType int
+
+const (
+	ArgString ArgType = iota // 单个词
+	ArgInt                   // 整数
+	ArgText                  // 剩余全部文本（只能是最后一个参数）
+)
+
+// Arg 命令参数定义
+type Arg struct {
+	Name     string   // 参数名
+	Type     ArgType  // 参数类型
+	Optional bool     // 是否可省略（可省略的参数只能在最后）
+	Choices  []string // 可选值（为空不限制）
+	Desc     string   // 参数说明
+}
+
+// usage 参数用法，例如 <name> [id] <list|enable>
+func (a Arg) usage() string {
+	name := a.Name
+	if len(a.Choices) > 0 {
+		name = strings.Join(a.Choices, "|")
+	} else if a.Type == ArgText {
+		name += "..."
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// Command 命令定义
+type Command struct {
+	Name        string        // 命令名（不含前缀）
+	Aliases     []string      // 别名
+	Description string        // 简短说明
+	Args        []Arg         // 参数定义
+	Usage       string        // 额外用法说明（可选，显示在 /help <cmd> 中）
+	Level       Level         // 所需权限等级
+	Scope       Scope         // 可用范围，0表示私聊和群聊
+	Available   event.Matcher // 可选，返回false时命令视为不存在（如插件被禁用）
+	Handler     func(ctx context.Context, call *Call) error
+}
+
+// Call 一次命令调用
+type Call struct {
+	Event   *protocol.Event
+	Command *Command
+	Args    Args
+	Level   Level // 调用者的权限等级
+
+	registry *Registry
+}
+
+// Reply 回复调用者
+func (c *Call) Reply(ctx context.Context, text string) {
+	c.registry.reply(ctx, c.Event, text)
+}
+
+// Args 解析后的参数
+type Args map[string]interface{}
+
+// Has 参数是否提供
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// String 获取字符串参数（ArgString/ArgText）
+func (a Args) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+// Int 获取整数参数（ArgInt）
+func (a Args) Int(name string) int64 {
+	v, _ := a[name].(int64)
+	return v
+}
+
+// token 命令文本中的一个词及其在原文中的位置
+type token struct {
+	text  string
+	start int
+}
+
+// tokenize 按空白切分命令文本，记录每个词的起始位置
+func tokenize(text string) []token {
+	tokens := make([]token, 0)
+	start := -1
+	for i, r := range text {
+		space := r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '　'
+		if space && start >= 0 {
+			tokens = append(tokens, token{text: text[start:i], start: start})
+			start = -1
+		} else if !space && start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text: text[start:], start: start})
+	}
+	return tokens
+}
+
+// parseArgs 按定义解析参数
+func parseArgs(defs []Arg, text string, tokens []token) (Args, error) {
+	args := make(Args)
+	i := 0
+	for _, def := range defs {
+		if i >= len(tokens) {
+			if def.Optional {
+				break
+			}
+			return nil, fmt.Errorf("缺少参数 %s", def.Name)
+		}
+
+		tok := tokens[i]
+		if def.Type == ArgText {
+			args[def.Name] = strings.TrimSpace(text[tok.start:])
+			return args, nil
+		}
+
+		if len(def.Choices) > 0 && !contains(def.Choices, tok.text) {
+			return nil, fmt.Errorf("参数 %s 只能是 %s", def.Name, strings.Join(def.Choices, "/"))
+		}
+
+		switch def.Type {
+		case ArgInt:
+			n, err := strconv.ParseInt(tok.text, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("参数 %s 必须是整数: %s", def.Name, tok.text)
+			}
+			args[def.Name] = n
+		default:
+			args[def.Name] = tok.text
+		}
+		i++
+	}
+
+	if i < len(tokens) {
+		return nil, fmt.Errorf("多余的参数: %s", tokens[i].text)
+	}
+	return args, nil
+}
+
+// contains 字符串列表是否包含
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
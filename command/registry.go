@@ -0,0 +1,239 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"strings"
+	"sync"
+)
+
+// Prefix 命令前缀
+const Prefix = "/"
+
+// ReplyFunc 回复函数
+type ReplyFunc func(ctx context.Context, e *protocol.Event, text string)
+
+// PermissionFunc 获取事件发送者的权限等级
+type PermissionFunc func(ctx context.Context, e *protocol.Event) Level
+
+// Registry 命令注册表（每个账号一个）
+type Registry struct {
+	mu         sync.RWMutex
+	commands   []*Command
+	byName     map[string]*Command // 名称和别名 -> 命令
+	reply      ReplyFunc
+	permission PermissionFunc
+}
+
+// NewRegistry 创建命令注册表，owners 为主人QQ号，并注册内置的 /help 命令
+func NewRegistry(reply ReplyFunc, owners []int64) *Registry {
+	r := &Registry{
+		commands:   make([]*Command, 0),
+		byName:     make(map[string]*Command),
+		reply:      reply,
+		permission: OwnerPermission(owners),
+	}
+
+	r.MustRegister(&Command{
+		Name:        "help",
+		Aliases:     []string{"帮助"},
+		Description: "显示帮助",
+		Args:        []Arg{{Name: "命令", Optional: true, Desc: "查看指定命令的详细用法"}},
+		Handler:     r.handleHelp,
+	})
+	return r
+}
+
+// OwnerPermission 主人为 LevelOwner，其他人为 LevelUser
+func OwnerPermission(owners []int64) PermissionFunc {
+	return func(ctx context.Context, e *protocol.Event) Level {
+		for _, owner := range owners {
+			if owner == e.UserID {
+				return LevelOwner
+			}
+		}
+		return LevelUser
+	}
+}
+
+// SetPermission 设置权限等级获取函数
+func (r *Registry) SetPermission(permission PermissionFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.permission = permission
+}
+
+// Register 注册命令，名称或别名重复时返回错误
+func (r *Registry) Register(cmd *Command) error {
+	if cmd.Name == "" || cmd.Handler == nil {
+		return fmt.Errorf("命令缺少名称或处理函数")
+	}
+	for i, arg := range cmd.Args {
+		if arg.Type == ArgText && i != len(cmd.Args)-1 {
+			return fmt.Errorf("命令 %s: 文本参数 %s 必须是最后一个参数", cmd.Name, arg.Name)
+		}
+		if i > 0 && cmd.Args[i-1].Optional && !arg.Optional {
+			return fmt.Errorf("命令 %s: 可省略参数之后不能有必填参数", cmd.Name)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		if _, exists := r.byName[name]; exists {
+			return fmt.Errorf("命令名重复: %s", name)
+		}
+	}
+	for _, name := range names {
+		r.byName[name] = cmd
+	}
+	r.commands = append(r.commands, cmd)
+	return nil
+}
+
+// MustRegister 注册命令，失败时panic（用于启动时注册内置命令）
+func (r *Registry) MustRegister(cmd *Command) {
+	if err := r.Register(cmd); err != nil {
+		panic(err)
+	}
+}
+
+// Attach 在分发器上注册命令规则（优先级10，处理后停止传播）
+func (r *Registry) Attach(d *event.Dispatcher) {
+	d.Handle(event.All(event.IsMessage(), event.Prefix(Prefix)), r.handle).
+		Priority(10).Block().Name("命令")
+}
+
+// lookup 根据名称或别名查找对该事件可用的命令
+func (r *Registry) lookup(name string, e *protocol.Event) *Command {
+	r.mu.RLock()
+	cmd := r.byName[name]
+	r.mu.RUnlock()
+
+	if cmd == nil || (cmd.Available != nil && !cmd.Available(e)) {
+		return nil
+	}
+	return cmd
+}
+
+// level 获取调用者权限等级
+func (r *Registry) level(ctx context.Context, e *protocol.Event) Level {
+	r.mu.RLock()
+	permission := r.permission
+	r.mu.RUnlock()
+	return permission(ctx, e)
+}
+
+// handle 解析并执行命令
+func (r *Registry) handle(ctx context.Context, e *protocol.Event) bool {
+	log := utils.Log(ctx)
+	text := strings.TrimPrefix(event.MessageText(e), Prefix)
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return true
+	}
+
+	name := tokens[0].text
+	cmd := r.lookup(name, e)
+	if cmd == nil {
+		// 群里其他机器人的命令或普通的斜杠开头消息很常见，没有@机器人时不提示
+		if e.MessageType == "group" && !event.Mentioned()(e) {
+			log.Debug("忽略群内未知命令: %s%s", Prefix, name)
+			return true
+		}
+		r.reply(ctx, e, "未知命令: "+Prefix+name+"\n输入 /help 查看可用命令")
+		return true
+	}
+
+	if !cmd.Scope.allows(e.MessageType) {
+		r.reply(ctx, e, fmt.Sprintf("命令 %s%s %s可用", Prefix, cmd.Name, cmd.Scope))
+		return true
+	}
+
+	level := r.level(ctx, e)
+	if level < cmd.Level {
+		log.Info("权限不足: QQ=%d 执行 %s%s 需要 %s", e.UserID, Prefix, cmd.Name, cmd.Level)
+		r.reply(ctx, e, "权限不足，需要"+cmd.Level.String()+"权限")
+		return true
+	}
+
+	args, err := parseArgs(cmd.Args, text, tokens[1:])
+	if err != nil {
+		r.reply(ctx, e, fmt.Sprintf("参数错误: %v\n用法: %s", err, usageLine(cmd)))
+		return true
+	}
+
+	call := &Call{Event: e, Command: cmd, Args: args, Level: level, registry: r}
+	if err := cmd.Handler(ctx, call); err != nil {
+		log.Error("执行命令 %s%s 失败: %v", Prefix, cmd.Name, err)
+		r.reply(ctx, e, "命令执行失败")
+	}
+	return true
+}
+
+// handleHelp 处理帮助命令：/help 列出可用命令，/help <命令> 显示详细用法
+func (r *Registry) handleHelp(ctx context.Context, call *Call) error {
+	e := call.Event
+
+	if call.Args.Has("命令") {
+		name := strings.TrimPrefix(call.Args.String("命令"), Prefix)
+		cmd := r.lookup(name, e)
+		if cmd == nil {
+			call.Reply(ctx, "未知命令: "+Prefix+name)
+			return nil
+		}
+		call.Reply(ctx, detail(cmd))
+		return nil
+	}
+
+	r.mu.RLock()
+	commands := append([]*Command(nil), r.commands...)
+	r.mu.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString("可用命令:")
+	for _, cmd := range commands {
+		if cmd.Level > call.Level || !cmd.Scope.allows(e.MessageType) ||
+			(cmd.Available != nil && !cmd.Available(e)) {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n%s%s - %s", Prefix, cmd.Name, cmd.Description))
+	}
+	sb.WriteString("\n输入 /help <命令> 查看详细用法")
+	call.Reply(ctx, sb.String())
+	return nil
+}
+
+// usageLine 命令用法行，例如 /plugin <list|enable|disable> [插件名]
+func usageLine(cmd *Command) string {
+	parts := []string{Prefix + cmd.Name}
+	for _, arg := range cmd.Args {
+		parts = append(parts, arg.usage())
+	}
+	return strings.Join(parts, " ")
+}
+
+// detail 命令详细说明
+func detail(cmd *Command) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s%s - %s\n用法: %s", Prefix, cmd.Name, cmd.Description, usageLine(cmd)))
+
+	for _, arg := range cmd.Args {
+		if arg.Desc != "" {
+			sb.WriteString(fmt.Sprintf("\n  %s: %s", arg.Name, arg.Desc))
+		}
+	}
+	if cmd.Usage != "" {
+		sb.WriteString("\n" + cmd.Usage)
+	}
+	if len(cmd.Aliases) > 0 {
+		sb.WriteString("\n别名: " + Prefix + strings.Join(cmd.Aliases, " "+Prefix))
+	}
+	sb.WriteString(fmt.Sprintf("\n范围: %s  权限: %s", cmd.Scope, cmd.Level))
+	return sb.String()
+}
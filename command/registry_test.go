@@ -0,0 +1,50 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"strings"
+	"testing"
+)
+
+func TestUnknownCommand(t *testing.T) {
+	var replies []string
+	r := NewRegistry(func(ctx context.Context, e *protocol.Event, text string) {
+		replies = append(replies, text)
+	}, nil)
+	d := event.NewDispatcher()
+	r.Attach(d)
+
+	tests := []struct {
+		name        string
+		messageType string
+		message     protocol.MessageChain
+		reply       string
+	}{
+		{"私聊提示", "private", protocol.NewMessage().Text("/foo").Build(), "未知命令: /foo"},
+		{"群聊未@时不提示", "group", protocol.NewMessage().Text("/foo").Build(), ""},
+		{"群聊@机器人时提示", "group", protocol.NewMessage().At(10001).Text(" /foo").Build(), "未知命令: /foo"},
+		{"群聊已知命令正常执行", "group", protocol.NewMessage().Text("/help").Build(), "可用命令"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies = nil
+			message, _ := json.Marshal(tt.message)
+			e := &protocol.Event{SelfID: 10001, PostType: "message", MessageType: tt.messageType, UserID: 123456, Message: message}
+			if tt.messageType == "group" {
+				e.GroupID = 888
+			}
+			d.Dispatch(context.Background(), e)
+
+			got := strings.Join(replies, "\n")
+			if tt.reply == "" && got != "" {
+				t.Fatalf("回复 = %q, 期望不回复", got)
+			}
+			if !strings.Contains(got, tt.reply) {
+				t.Fatalf("回复 = %q, 期望包含 %q", got, tt.reply)
+			}
+		})
+	}
+}
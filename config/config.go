@@ -3,23 +3,196 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"time"
 )
 
 // Config 总配置
 type Config struct {
-	NapCat     *NapCatConfig   `json:"napcat"`
-	AI         *AIConfig       `json:"ai"`
-	Database   *DatabaseConfig `json:"database"`
-	AllowedQQs []int64         `json:"allowed_qqs"` // 允许使用的QQ号白名单
+	NapCat     *NapCatConfig     `json:"napcat"`
+	Accounts   []*AccountConfig  `json:"accounts,omitempty"` // 多账号配置（为空时使用napcat和allowed_qqs）
+	AI         *AIConfig         `json:"ai"`
+	Database   *DatabaseConfig   `json:"database"`
+	Outbox     *OutboxConfig     `json:"outbox"`
+	Dispatch   *DispatchConfig   `json:"dispatch"`
+	Recorder   *RecorderConfig   `json:"recorder"`
+	History    *HistoryConfig    `json:"history"`
+	Permission *PermissionConfig `json:"permission"`
+	GroupChat  *GroupChatConfig  `json:"group_chat"`
+	Burst      *BurstConfig      `json:"burst"`
+	AllowedQQs []int64           `json:"allowed_qqs"` // 允许使用的QQ号白名单
+	Owners     []int64           `json:"owners"`      // 机器人主人QQ号（可使用管理命令）
+}
+
+// BurstConfig 连续消息聚合配置
+type BurstConfig struct {
+	Windows []int `json:"windows"`  // 各关系阶段（陌生/熟悉/亲近/亲密）等待用户继续发送的时间(ms)，0表示不等待
+	MaxWait int   `json:"max_wait"` // 最长聚合时间(ms)，用户一直发送时到时也会回复
+}
+
+// GetWindows 各关系阶段的等待时间（未配置时使用默认值，要关闭聚合请把各阶段设为0）
+func (c *BurstConfig) GetWindows() []time.Duration {
+	windows := GetDefault().Burst.Windows
+	if c != nil && len(c.Windows) > 0 {
+		windows = c.Windows
+	}
+
+	durations := make([]time.Duration, 0, len(windows))
+	for _, ms := range windows {
+		durations = append(durations, time.Duration(ms)*time.Millisecond)
+	}
+	return durations
+}
+
+// GetMaxWait 最长聚合时间（未配置或不大于0时使用默认值）
+func (c *BurstConfig) GetMaxWait() time.Duration {
+	ms := GetDefault().Burst.MaxWait
+	if c != nil && c.MaxWait > 0 {
+		ms = c.MaxWait
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// GroupChatConfig 群聊参与策略
+type GroupChatConfig struct {
+	Mode                string   `json:"mode"`                 // all(回复所有消息)/smart(被@、提到关键词、回复机器人消息时回复，其余按兴趣概率参与)
+	Keywords            []string `json:"keywords"`             // 人设名字等关键词，出现时参与
+	ReplyToBot          bool     `json:"reply_to_bot"`         // 回复机器人的消息时是否回复
+	InterestProbability float64  `json:"interest_probability"` // 未被点名时主动参与的基础概率 0-1
+	Cooldown            int      `json:"cooldown"`             // 关键词/兴趣参与后同一群的冷却时间(秒)，被@和回复不受限制
+}
+
+// PermissionConfig 权限配置
+type PermissionConfig struct {
+	Public         bool   `json:"public"`           // 是否允许所有人使用（否则只有白名单、白名单群成员和已授权角色的用户）
+	GroupAdminRole string `json:"group_admin_role"` // 白名单群的群主/管理员在本群的角色 admin/trusted/user，为空不提升
+}
+
+// HistoryConfig 对话历史配置
+type HistoryConfig struct {
+	UndoWindow    int `json:"undo_window"`    // 全局清空后可撤销的时间(分钟)，超时后彻底删除
+	GroupContext  int `json:"group_context"`  // 群聊时带入提示词的群聊记录条数
+	RetentionDays int `json:"retention_days"` // 对话历史和群聊记录保留天数，超过后彻底删除
+}
+
+// GetUndoWindow 全局清空后可撤销的时间（未配置或不大于0时使用默认值）
+func (c *HistoryConfig) GetUndoWindow() time.Duration {
+	minutes := GetDefault().History.UndoWindow
+	if c != nil && c.UndoWindow > 0 {
+		minutes = c.UndoWindow
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// GetGroupContext 群聊记录条数（未配置或不大于0时使用默认值，旧配置文件没有该项）
+func (c *HistoryConfig) GetGroupContext() int {
+	if c != nil && c.GroupContext > 0 {
+		return c.GroupContext
+	}
+	return GetDefault().History.GroupContext
+}
+
+// GetRetentionDays 对话历史保留天数（未配置或不大于0时使用默认值，旧配置文件没有该项）
+func (c *HistoryConfig) GetRetentionDays() int {
+	if c != nil && c.RetentionDays > 0 {
+		return c.RetentionDays
+	}
+	return GetDefault().History.RetentionDays
+}
+
+// RecorderConfig 流量录制配置
+type RecorderConfig struct {
+	Enabled bool   `json:"enabled"` // 是否录制收发的数据帧
+	Path    string `json:"path"`    // 录制文件路径(JSONL)
+}
+
+// DispatchConfig 事件处理池配置
+type DispatchConfig struct {
+	Workers    int    `json:"workers"`     // 最大并发处理数
+	QueueSize  int    `json:"queue_size"`  // 单会话排队上限
+	MaxPending int    `json:"max_pending"` // 全局排队上限
+	Overflow   string `json:"overflow"`    // 溢出策略 drop_newest/drop_oldest/block（block在单独的提交队列中等待，不阻塞连接读取）
+	Timeout    int    `json:"timeout"`     // 单个事件处理超时(秒)
+}
+
+// OutboxConfig 发件箱配置
+type OutboxConfig struct {
+	TargetInterval int `json:"target_interval"` // 同一用户/群两条消息的最小间隔(ms)
+	GlobalInterval int `json:"global_interval"` // 全局两条消息的最小间隔(ms)
+	MaxAttempts    int `json:"max_attempts"`    // 最大发送尝试次数
+	RetryInterval  int `json:"retry_interval"`  // 重试基础间隔(ms)，按尝试次数递增
+	RetentionDays  int `json:"retention_days"`  // 已发送/已放弃的消息保留天数，超过后删除
+}
+
+// GetRetention 已发送/已放弃消息的保留时间（未配置或不大于0时使用默认值，旧配置文件没有该项）
+func (c *OutboxConfig) GetRetention() time.Duration {
+	days := GetDefault().Outbox.RetentionDays
+	if c != nil && c.RetentionDays > 0 {
+		days = c.RetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// AccountConfig 单个QQ账号配置
+type AccountConfig struct {
+	SelfID     int64            `json:"self_id"`     // 机器人QQ号
+	NapCat     *NapCatConfig    `json:"napcat"`      // 该账号的NapCat连接
+	PromptDir  string           `json:"prompt_dir"`  // 人设提示词目录
+	AllowedQQs []int64          `json:"allowed_qqs"` // 该账号的QQ号白名单
+	Owners     []int64          `json:"owners"`      // 该账号的主人QQ号（为空时使用全局owners）
+	GroupChat  *GroupChatConfig `json:"group_chat"`  // 该账号的群聊参与策略（为空时使用全局group_chat）
+}
+
+// DefaultPromptDir 默认人设提示词目录
+const DefaultPromptDir = "system_prompts"
+
+// GetAccounts 获取账号列表（未配置accounts时使用单账号配置）
+func (c *Config) GetAccounts() []*AccountConfig {
+	accounts := c.Accounts
+	if len(accounts) == 0 {
+		selfID := int64(0)
+		if c.NapCat != nil {
+			selfID = c.NapCat.SelfID
+		}
+		accounts = []*AccountConfig{{
+			SelfID:     selfID,
+			NapCat:     c.NapCat,
+			AllowedQQs: c.AllowedQQs,
+		}}
+	}
+
+	for _, acc := range accounts {
+		if acc.PromptDir == "" {
+			acc.PromptDir = DefaultPromptDir
+		}
+		if len(acc.Owners) == 0 {
+			acc.Owners = c.Owners
+		}
+		if acc.GroupChat == nil {
+			acc.GroupChat = c.GroupChat
+		}
+		if acc.NapCat != nil && acc.NapCat.SelfID == 0 {
+			acc.NapCat.SelfID = acc.SelfID
+		}
+	}
+	return accounts
 }
 
 // NapCatConfig NapCat连接配置
 type NapCatConfig struct {
-	Host              string `json:"host"`               // 主机地址
-	Port              int    `json:"port"`               // 端口
-	Token             string `json:"token"`              // 访问令牌
-	HeartbeatInterval int    `json:"heartbeat_interval"` // 心跳间隔(ms)
-	MessageFormat     string `json:"message_format"`     // 消息格式 array/string
+	Mode                 string `json:"mode"`                   // 连接模式 ws(正向)/ws-reverse(反向)/http
+	Host                 string `json:"host"`                   // 主机地址
+	Port                 int    `json:"port"`                   // 端口
+	Token                string `json:"token"`                  // 访问令牌
+	HeartbeatInterval    int    `json:"heartbeat_interval"`     // 心跳间隔(ms)
+	HeartbeatMissed      int    `json:"heartbeat_missed"`       // 连续错过N个心跳周期判定连接失活
+	ReconnectInterval    int    `json:"reconnect_interval"`     // 初始重连间隔(ms)，之后指数退避
+	ReconnectMaxInterval int    `json:"reconnect_max_interval"` // 最大重连间隔(ms)
+	MessageFormat        string `json:"message_format"`         // 消息格式 array/string
+	ListenHost           string `json:"listen_host"`            // 反向/HTTP模式监听地址
+	ListenPort           int    `json:"listen_port"`            // 反向/HTTP模式监听端口
+	ListenPath           string `json:"listen_path"`            // 反向/HTTP模式路径
+	SelfID               int64  `json:"self_id"`                // 机器人QQ号（校验X-Self-ID，0表示不校验）
+	Secret               string `json:"secret"`                 // HTTP上报签名密钥（X-Signature）
 }
 
 // AIConfig AI模型配置
@@ -68,11 +241,18 @@ func Get() *Config {
 func GetDefault() *Config {
 	return &Config{
 		NapCat: &NapCatConfig{
-			Host:              "127.0.0.1",
-			Port:              3001,
-			Token:             "X9?Hl=AJnpjWM(bw",
-			HeartbeatInterval: 30000,
-			MessageFormat:     "array",
+			Mode:                 "ws",
+			Host:                 "127.0.0.1",
+			Port:                 3001,
+			Token:                "X9?Hl=AJnpjWM(bw",
+			HeartbeatInterval:    30000,
+			HeartbeatMissed:      3,
+			ReconnectInterval:    1000,
+			ReconnectMaxInterval: 60000,
+			MessageFormat:        "array",
+			ListenHost:           "0.0.0.0",
+			ListenPort:           3002,
+			ListenPath:           "/onebot/v11/ws",
 		},
 		AI: &AIConfig{
 			BaseURL:     "https://api.deepseek.com",
@@ -81,6 +261,44 @@ func GetDefault() *Config {
 			MaxTokens:   500,
 			Temperature: 0.95,
 		},
+		Outbox: &OutboxConfig{
+			TargetInterval: 800,
+			GlobalInterval: 200,
+			MaxAttempts:    5,
+			RetryInterval:  2000,
+			RetentionDays:  7,
+		},
+		Dispatch: &DispatchConfig{
+			Workers:    16,
+			QueueSize:  32,
+			MaxPending: 1024,
+			Overflow:   "drop_newest",
+			Timeout:    120,
+		},
+		Permission: &PermissionConfig{
+			Public:         false,
+			GroupAdminRole: "admin",
+		},
+		GroupChat: &GroupChatConfig{
+			Mode:                "smart",
+			Keywords:            []string{},
+			ReplyToBot:          true,
+			InterestProbability: 0.05,
+			Cooldown:            300,
+		},
+		Burst: &BurstConfig{
+			Windows: []int{4000, 3000, 2500, 2000},
+			MaxWait: 15000,
+		},
+		History: &HistoryConfig{
+			UndoWindow:    1440,
+			GroupContext:  50,
+			RetentionDays: 90,
+		},
+		Recorder: &RecorderConfig{
+			Enabled: false,
+			Path:    "traffic.jsonl",
+		},
 		Database: &DatabaseConfig{
 			Host:     "localhost",
 			Port:     5432,
@@ -90,6 +308,7 @@ func GetDefault() *Config {
 			SSLMode:  "disable",
 		},
 		AllowedQQs: []int64{}, // 默认空，需要手动添加QQ号
+		Owners:     []int64{}, // 默认空，需要手动添加主人QQ号
 	}
 }
 
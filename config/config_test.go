@@ -0,0 +1,35 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBurstConfigDefaults(t *testing.T) {
+	defaultWindows := []time.Duration{4 * time.Second, 3 * time.Second, 2500 * time.Millisecond, 2 * time.Second}
+
+	tests := []struct {
+		name    string
+		config  *BurstConfig
+		windows []time.Duration
+		maxWait time.Duration
+	}{
+		{"未配置", nil, defaultWindows, 15 * time.Second},
+		{"空配置", &BurstConfig{}, defaultWindows, 15 * time.Second},
+		{"负数最长时间", &BurstConfig{Windows: []int{1000}, MaxWait: -1}, []time.Duration{time.Second}, 15 * time.Second},
+		{"关闭聚合", &BurstConfig{Windows: []int{0}}, []time.Duration{0}, 15 * time.Second},
+		{"自定义", &BurstConfig{Windows: []int{300, 200}, MaxWait: 3000}, []time.Duration{300 * time.Millisecond, 200 * time.Millisecond}, 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.GetWindows(); !reflect.DeepEqual(got, tt.windows) {
+				t.Errorf("GetWindows() = %v, 期望 %v", got, tt.windows)
+			}
+			if got := tt.config.GetMaxWait(); got != tt.maxWait {
+				t.Errorf("GetMaxWait() = %v, 期望 %v", got, tt.maxWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"sync/atomic"
+	"time"
+)
+
+// 连接模式
+const (
+	ModeForward = "ws"         // 正向WebSocket（机器人主动连接NapCat）
+	ModeReverse = "ws-reverse" // 反向WebSocket（NapCat连接机器人）
+	ModeHTTP    = "http"       // HTTP（NapCat POST上报事件，机器人HTTP调用API）
+)
+
+// Connection NapCat连接
+type Connection interface {
+	Start() error
+	Stop() error
+	SendMessage(ctx context.Context, data []byte) error // 上下文取消或超时时放弃发送（HTTP模式下取消进行中的请求）
+	SetResponseHandler(handler func(*protocol.Response) bool)
+	SetRecorder(recorder *Recorder)
+	IsRunning() bool
+	State() State
+	OnStateChange(listener StateListener)
+	Health() Health
+}
+
+// New 根据配置的连接模式创建连接
+func New(cfg *config.NapCatConfig, handler func(*protocol.Event)) (Connection, error) {
+	switch cfg.Mode {
+	case "", ModeForward:
+		return NewWSClient(cfg, handler), nil
+	case ModeReverse:
+		return NewWSServer(cfg, handler), nil
+	case ModeHTTP:
+		return NewHTTPConnection(cfg, handler), nil
+	default:
+		return nil, fmt.Errorf("未知的连接模式: %s", cfg.Mode)
+	}
+}
+
+// heartbeatFallback 尚未收到心跳事件时使用的检测间隔
+func heartbeatFallback(cfg *config.NapCatConfig) time.Duration {
+	return time.Duration(cfg.HeartbeatInterval) * time.Millisecond
+}
+
+// frameRouter 数据帧路由（各连接内嵌共用）：录制、死链检测、区分事件和API响应
+type frameRouter struct {
+	selfID          *atomic.Int64 // 连接所属账号（反向WS连接建立时更新，读取goroutine并发读取）
+	eventHandler    func(*protocol.Event)
+	responseHandler func(*protocol.Response) bool
+	watchdog        *watchdog
+	recorder        *Recorder
+}
+
+// newFrameRouter 创建数据帧路由
+func newFrameRouter(cfg *config.NapCatConfig, handler func(*protocol.Event)) frameRouter {
+	selfID := new(atomic.Int64)
+	selfID.Store(cfg.SelfID)
+
+	return frameRouter{
+		selfID:       selfID,
+		eventHandler: handler,
+		watchdog:     newWatchdog(cfg.HeartbeatMissed, heartbeatFallback(cfg)),
+	}
+}
+
+// SetResponseHandler 设置API响应处理器（通常为 protocol.API.HandleResponse）
+func (r *frameRouter) SetResponseHandler(handler func(*protocol.Response) bool) {
+	r.responseHandler = handler
+}
+
+// SetRecorder 设置流量录制器（nil表示不录制）
+func (r *frameRouter) SetRecorder(recorder *Recorder) {
+	r.recorder = recorder
+}
+
+// recordOutbound 录制发出的数据帧
+func (r *frameRouter) recordOutbound(data []byte) {
+	r.recorder.Record(r.selfID.Load(), DirectionOut, data)
+}
+
+// dispatch 解析数据帧并分发给事件处理器或API响应处理器
+func (r *frameRouter) dispatch(data []byte) {
+	r.recorder.Record(r.selfID.Load(), DirectionIn, data)
+	r.watchdog.touch()
+
+	event, resp, err := protocol.ParseFrame(data)
+	if err != nil {
+		utils.Error("解析事件错误: %v, 原始数据: %s", err, string(data))
+		return
+	}
+
+	// API响应交给等待中的调用
+	if resp != nil {
+		if r.responseHandler == nil || !r.responseHandler(resp) {
+			utils.Debug("收到未匹配的API响应: echo=%s, retcode=%d", resp.Echo, resp.RetCode)
+		}
+		return
+	}
+
+	r.watchdog.observe(event)
+
+	// 处理事件（由调用方负责排队，不应阻塞读取）
+	if r.eventHandler != nil {
+		r.eventHandler(event)
+	}
+}
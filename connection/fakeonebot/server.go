@@ -0,0 +1,502 @@
+// Package fakeonebot 进程内的假NapCat/OneBot v11服务端（正向WebSocket，也可作为反向WebSocket客户端），
+// 用于离线集成测试：注入事件、捕获动作、用预设响应应答API调用、模拟断线
+package fakeonebot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"qq_bot/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Action 收到的API调用
+type Action struct {
+	Action string                 `json:"action"`
+	Params map[string]interface{} `json:"params"`
+	Echo   string                 `json:"echo"`
+	Time   time.Time              `json:"-"`
+}
+
+// ActionHandler 自定义动作处理，返回响应data和retcode（0表示成功）
+type ActionHandler func(params map[string]interface{}) (data interface{}, retcode int)
+
+// Server 假OneBot服务端
+type Server struct {
+	SelfID   int64
+	Token    string
+	listener net.Listener
+	server   *http.Server
+	upgrader websocket.Upgrader
+	mu       sync.Mutex
+	conns    map[*websocket.Conn]*sync.Mutex // 连接 -> 写锁
+	handlers map[string]ActionHandler
+	actions  []Action
+	msgSeq   int32
+	refuse   bool
+	notify   chan struct{} // 有新动作或新连接时广播
+}
+
+// New 创建假OneBot服务端
+func New(selfID int64, token string) *Server {
+	s := &Server{
+		SelfID:   selfID,
+		Token:    token,
+		conns:    make(map[*websocket.Conn]*sync.Mutex),
+		handlers: make(map[string]ActionHandler),
+		notify:   make(chan struct{}),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+
+	s.Handle("send_private_msg", s.handleSendMessage)
+	s.Handle("send_group_msg", s.handleSendMessage)
+	s.Handle("send_msg", s.handleSendMessage)
+	s.Respond("get_login_info", map[string]interface{}{
+		"user_id":  selfID,
+		"nickname": "FakeBot",
+	})
+	s.Respond("get_version_info", map[string]interface{}{
+		"app_name":         "NapCat.Onebot",
+		"app_version":      "fake",
+		"protocol_version": "v11",
+	})
+	s.Respond("get_status", map[string]interface{}{"online": true, "good": true})
+
+	// NapCat扩展动作默认直接成功
+	for _, action := range []string{
+		"set_input_status", "friend_poke", "group_poke", "set_msg_emoji_like",
+		"mark_private_msg_as_read", "mark_group_msg_as_read",
+	} {
+		s.Respond(action, nil)
+	}
+	return s
+}
+
+// Start 在本地随机端口启动
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("监听失败: %v", err)
+	}
+	s.listener = ln
+	s.server = &http.Server{Handler: s}
+
+	go s.server.Serve(ln)
+	return nil
+}
+
+// Close 关闭服务端和所有连接
+func (s *Server) Close() error {
+	s.Disconnect()
+	if s.server != nil {
+		return s.server.Close()
+	}
+	return nil
+}
+
+// Addr 监听地址
+func (s *Server) Addr() (string, int) {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Config 生成连接到该服务端的正向WebSocket配置
+func (s *Server) Config() *config.NapCatConfig {
+	host, port := s.Addr()
+	return &config.NapCatConfig{
+		Mode:                 "ws",
+		Host:                 host,
+		Port:                 port,
+		Token:                s.Token,
+		HeartbeatInterval:    30000,
+		HeartbeatMissed:      3,
+		ReconnectInterval:    50,
+		ReconnectMaxInterval: 500,
+		MessageFormat:        "array",
+		SelfID:               s.SelfID,
+	}
+}
+
+// ReverseConfig 生成反向WebSocket配置（机器人在本地空闲端口监听，由DialReverse连接）
+func (s *Server) ReverseConfig() (*config.NapCatConfig, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("分配端口失败: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	return &config.NapCatConfig{
+		Mode:              "ws-reverse",
+		ListenHost:        "127.0.0.1",
+		ListenPort:        port,
+		ListenPath:        "/onebot",
+		Token:             s.Token,
+		HeartbeatInterval: 30000,
+		HeartbeatMissed:   3,
+		MessageFormat:     "array",
+		SelfID:            s.SelfID,
+	}, nil
+}
+
+// DialReverse 像NapCat反向WebSocket一样主动连接机器人，连接建立后与正向连接一样注入事件和应答API调用
+func (s *Server) DialReverse(ctx context.Context, cfg *config.NapCatConfig) error {
+	url := fmt.Sprintf("ws://%s:%d%s", cfg.ListenHost, cfg.ListenPort, cfg.ListenPath)
+	header := http.Header{}
+	header.Set("X-Self-ID", fmt.Sprintf("%d", s.SelfID))
+	header.Set("X-Client-Role", "Universal")
+	if s.Token != "" {
+		header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return fmt.Errorf("连接机器人失败: %v", err)
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = &sync.Mutex{}
+	s.broadcast()
+	s.mu.Unlock()
+
+	go s.readLoop(conn)
+	return nil
+}
+
+// ServeHTTP 处理机器人的WebSocket连接
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	refuse := s.refuse
+	s.mu.Unlock()
+
+	if refuse {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.Token != "" && strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") != s.Token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = &sync.Mutex{}
+	s.broadcast()
+	s.mu.Unlock()
+
+	s.readLoop(conn)
+}
+
+// readLoop 读取机器人发来的API调用并应答
+func (s *Server) readLoop(conn *websocket.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var action Action
+		if err := json.Unmarshal(data, &action); err != nil {
+			continue
+		}
+		action.Time = time.Now()
+
+		s.mu.Lock()
+		s.actions = append(s.actions, action)
+		handler := s.handlers[action.Action]
+		s.broadcast()
+		s.mu.Unlock()
+
+		resp := map[string]interface{}{
+			"status":  "ok",
+			"retcode": 0,
+			"data":    nil,
+			"echo":    action.Echo,
+		}
+		if handler == nil {
+			resp["status"] = "failed"
+			resp["retcode"] = 1404
+			resp["message"] = "不支持的动作: " + action.Action
+		} else {
+			respData, retcode := handler(action.Params)
+			resp["data"] = respData
+			if retcode != 0 {
+				resp["status"] = "failed"
+				resp["retcode"] = retcode
+			}
+		}
+
+		s.write(conn, resp)
+	}
+}
+
+// handleSendMessage 默认的发送消息处理：返回自增message_id
+func (s *Server) handleSendMessage(params map[string]interface{}) (interface{}, int) {
+	s.mu.Lock()
+	s.msgSeq++
+	id := s.msgSeq
+	s.mu.Unlock()
+	return map[string]interface{}{"message_id": id}, 0
+}
+
+// Handle 注册动作处理函数（覆盖默认处理）
+func (s *Server) Handle(action string, handler ActionHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[action] = handler
+}
+
+// Respond 为动作设置固定的成功响应
+func (s *Server) Respond(action string, data interface{}) {
+	s.Handle(action, func(map[string]interface{}) (interface{}, int) {
+		return data, 0
+	})
+}
+
+// Fail 让动作固定返回失败
+func (s *Server) Fail(action string, retcode int) {
+	s.Handle(action, func(map[string]interface{}) (interface{}, int) {
+		return nil, retcode
+	})
+}
+
+// InjectEvent 向所有连接推送任意事件
+func (s *Server) InjectEvent(event map[string]interface{}) error {
+	if _, ok := event["time"]; !ok {
+		event["time"] = time.Now().Unix()
+	}
+	if _, ok := event["self_id"]; !ok {
+		event["self_id"] = s.SelfID
+	}
+
+	s.mu.Lock()
+	conns := make(map[*websocket.Conn]*sync.Mutex, len(s.conns))
+	for conn, lock := range s.conns {
+		conns[conn] = lock
+	}
+	s.mu.Unlock()
+
+	if len(conns) == 0 {
+		return fmt.Errorf("没有已连接的客户端")
+	}
+	for conn, lock := range conns {
+		lock.Lock()
+		err := conn.WriteJSON(event)
+		lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InjectPrivateMessage 推送私聊消息事件，返回message_id
+func (s *Server) InjectPrivateMessage(userID int64, nickname, text string) (int32, error) {
+	id := s.nextMessageID()
+	return id, s.InjectEvent(map[string]interface{}{
+		"post_type":    "message",
+		"message_type": "private",
+		"sub_type":     "friend",
+		"message_id":   id,
+		"user_id":      userID,
+		"message":      textMessage(text),
+		"raw_message":  text,
+		"font":         0,
+		"sender": map[string]interface{}{
+			"user_id":  userID,
+			"nickname": nickname,
+		},
+	})
+}
+
+// InjectGroupMessage 推送群消息事件，返回message_id
+func (s *Server) InjectGroupMessage(groupID, userID int64, nickname, role, text string) (int32, error) {
+	id := s.nextMessageID()
+	return id, s.InjectEvent(map[string]interface{}{
+		"post_type":    "message",
+		"message_type": "group",
+		"sub_type":     "normal",
+		"message_id":   id,
+		"group_id":     groupID,
+		"user_id":      userID,
+		"message":      textMessage(text),
+		"raw_message":  text,
+		"font":         0,
+		"sender": map[string]interface{}{
+			"user_id":  userID,
+			"nickname": nickname,
+			"card":     "",
+			"role":     role,
+		},
+	})
+}
+
+// InjectNotice 推送通知事件
+func (s *Server) InjectNotice(noticeType string, fields map[string]interface{}) error {
+	event := map[string]interface{}{
+		"post_type":   "notice",
+		"notice_type": noticeType,
+	}
+	for k, v := range fields {
+		event[k] = v
+	}
+	return s.InjectEvent(event)
+}
+
+// InjectHeartbeat 推送心跳元事件
+func (s *Server) InjectHeartbeat(intervalMs int64, online bool) error {
+	return s.InjectEvent(map[string]interface{}{
+		"post_type":       "meta_event",
+		"meta_event_type": "heartbeat",
+		"interval":        intervalMs,
+		"status": map[string]interface{}{
+			"online": online,
+			"good":   online,
+		},
+	})
+}
+
+// Actions 获取收到的全部API调用
+func (s *Server) Actions() []Action {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Action(nil), s.actions...)
+}
+
+// SentMessages 获取收到的send_*_msg调用
+func (s *Server) SentMessages() []Action {
+	result := make([]Action, 0)
+	for _, a := range s.Actions() {
+		if strings.HasPrefix(a.Action, "send_") && strings.HasSuffix(a.Action, "_msg") {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// Reset 清空已记录的API调用
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions = nil
+}
+
+// WaitAction 等待收到指定动作的第n次调用（n从1开始）
+func (s *Server) WaitAction(ctx context.Context, action string, n int) (Action, error) {
+	for {
+		s.mu.Lock()
+		count := 0
+		for _, a := range s.actions {
+			if a.Action == action {
+				count++
+				if count == n {
+					s.mu.Unlock()
+					return a, nil
+				}
+			}
+		}
+		ch := s.notify
+		s.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return Action{}, fmt.Errorf("等待动作 %s 超时: %v", action, ctx.Err())
+		}
+	}
+}
+
+// WaitConnected 等待至少一个客户端连接
+func (s *Server) WaitConnected(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		connected := len(s.conns) > 0
+		ch := s.notify
+		s.mu.Unlock()
+
+		if connected {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return fmt.Errorf("等待连接超时: %v", ctx.Err())
+		}
+	}
+}
+
+// Disconnect 断开所有客户端连接（模拟NapCat重启或网络中断）
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	conns := make([]*websocket.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// SetRefuse 设置是否拒绝新连接（模拟NapCat未启动）
+func (s *Server) SetRefuse(refuse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+// write 向单个连接写入JSON
+func (s *Server) write(conn *websocket.Conn, v interface{}) {
+	s.mu.Lock()
+	lock := s.conns[conn]
+	s.mu.Unlock()
+
+	if lock == nil {
+		return
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	conn.WriteJSON(v)
+}
+
+// nextMessageID 生成消息ID
+func (s *Server) nextMessageID() int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgSeq++
+	return s.msgSeq
+}
+
+// broadcast 唤醒所有等待者（调用方持有锁）
+func (s *Server) broadcast() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// textMessage 构建纯文本array消息
+func textMessage(text string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"type": "text", "data": map[string]interface{}{"text": text}},
+	}
+}
@@ -0,0 +1,262 @@
+package fakeonebot_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"qq_bot/connection"
+	"qq_bot/connection/fakeonebot"
+	"qq_bot/protocol"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startClient 启动假服务端并用正向WebSocket客户端连接，返回客户端API和收到的事件
+func startClient(t *testing.T) (*fakeonebot.Server, *connection.WSClient, *protocol.API, <-chan *protocol.Event) {
+	t.Helper()
+
+	srv := fakeonebot.New(10001, "token")
+	if err := srv.Start(); err != nil {
+		t.Fatalf("启动假服务端失败: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	events := make(chan *protocol.Event, 16)
+	client := connection.NewWSClient(srv.Config(), func(e *protocol.Event) {
+		events <- e
+	})
+	api := protocol.NewAPI(client.SendMessage)
+	client.SetResponseHandler(api.HandleResponse)
+	if err := client.Start(); err != nil {
+		t.Fatalf("启动客户端失败: %v", err)
+	}
+	t.Cleanup(func() { client.Stop() })
+
+	waitState(t, client, true)
+	return srv, client, api, events
+}
+
+// waitState 等待客户端进入（connected为false时离开）已连接状态
+func waitState(t *testing.T, client *connection.WSClient, connected bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (client.State() == connection.StateConnected) != connected {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待连接状态超时, 当前 %s", client.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testContext 带超时的测试上下文
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestEchoCorrelation(t *testing.T) {
+	srv, _, api, _ := startClient(t)
+	ctx := testContext(t)
+
+	// 响应按参数生成，并发调用时每个调用都应拿到自己的响应
+	srv.Handle("get_stranger_info", func(params map[string]interface{}) (interface{}, int) {
+		userID := int64(params["user_id"].(float64))
+		return map[string]interface{}{"user_id": userID, "nickname": fmt.Sprintf("用户%d", userID)}, 0
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := int64(1); i <= 20; i++ {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			info, err := api.GetStrangerInfo(ctx, userID, false)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if info.UserID != userID || info.Nickname != fmt.Sprintf("用户%d", userID) {
+				errs <- fmt.Errorf("调用 %d 收到了错误的响应: %+v", userID, info)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// 预设响应
+	srv.Respond("get_login_info", map[string]interface{}{"user_id": 10001, "nickname": "小雪"})
+	info, err := api.GetLoginInfo(ctx)
+	if err != nil {
+		t.Fatalf("GetLoginInfo失败: %v", err)
+	}
+	if info.Nickname != "小雪" {
+		t.Errorf("昵称 = %q, 期望 小雪", info.Nickname)
+	}
+	action, err := srv.WaitAction(ctx, "get_login_info", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Echo == "" {
+		t.Error("API调用缺少echo")
+	}
+
+	// 失败响应转换为APIError
+	srv.Fail("send_private_msg", 1200)
+	_, err = api.SendPrivateMessage(ctx, 123456, "在吗")
+	var apiErr *protocol.APIError
+	if !errors.As(err, &apiErr) || apiErr.RetCode != 1200 {
+		t.Fatalf("发送失败时错误 = %v, 期望retcode=1200的APIError", err)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv, client, api, events := startClient(t)
+	ctx := testContext(t)
+
+	// NapCat重启期间拒绝连接，客户端保持重连
+	srv.SetRefuse(true)
+	srv.Disconnect()
+	waitState(t, client, false)
+
+	time.Sleep(200 * time.Millisecond)
+	if state := client.State(); state == connection.StateConnected {
+		t.Fatalf("拒绝连接期间状态 = %s", state)
+	}
+
+	srv.SetRefuse(false)
+	waitState(t, client, true)
+	if err := srv.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重连后API调用和事件推送都正常
+	if _, err := api.GetLoginInfo(ctx); err != nil {
+		t.Fatalf("重连后API调用失败: %v", err)
+	}
+	if _, err := srv.InjectPrivateMessage(123456, "小明", "还在吗"); err != nil {
+		t.Fatalf("推送事件失败: %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.UserID != 123456 || e.Segments().PlainText() != "还在吗" {
+			t.Errorf("收到事件 = %+v", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("重连后未收到推送的事件")
+	}
+}
+
+func TestReverseReconnect(t *testing.T) {
+	srv := fakeonebot.New(10001, "token")
+	cfg, err := srv.ReverseConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	events := make(chan *protocol.Event, 16)
+	server := connection.NewWSServer(cfg, func(e *protocol.Event) {
+		if e.PostType == "message" {
+			events <- e
+		}
+	})
+	recorder, err := connection.NewRecorder(filepath.Join(t.TempDir(), "frames.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+	server.SetRecorder(recorder)
+	api := protocol.NewAPI(server.SendMessage)
+	server.SetResponseHandler(api.HandleResponse)
+	if err := server.Start(); err != nil {
+		t.Fatalf("启动反向WebSocket服务失败: %v", err)
+	}
+	t.Cleanup(func() { server.Stop() })
+
+	ctx := testContext(t)
+	expectEvent := func(text string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.SelfID != 10001 || e.Segments().PlainText() != text {
+				t.Errorf("收到事件 = %+v, 期望 %q", e, text)
+			}
+		case <-ctx.Done():
+			t.Fatalf("未收到推送的事件 %q", text)
+		}
+	}
+
+	// 首次连接
+	if err := srv.DialReverse(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitServerState(t, server, connection.StateConnected)
+	if _, err := srv.InjectPrivateMessage(123456, "小明", "在吗"); err != nil {
+		t.Fatalf("推送事件失败: %v", err)
+	}
+	expectEvent("在吗")
+
+	// NapCat重启：断开后重新连接
+	srv.Disconnect()
+	waitServerState(t, server, connection.StateConnecting)
+	if err := srv.DialReverse(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitServerState(t, server, connection.StateConnected)
+
+	// 旧连接仍在推送时新连接替换它，读取和连接建立并发进行
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				srv.InjectHeartbeat(30000, true)
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := srv.DialReverse(ctx, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	waitServerState(t, server, connection.StateConnected)
+
+	if server.SelfID() != 10001 {
+		t.Errorf("SelfID = %d, 期望 10001", server.SelfID())
+	}
+	if _, err := api.GetLoginInfo(ctx); err != nil {
+		t.Fatalf("重连后API调用失败: %v", err)
+	}
+	if _, err := srv.InjectPrivateMessage(123456, "小明", "还在吗"); err != nil {
+		t.Fatalf("推送事件失败: %v", err)
+	}
+	expectEvent("还在吗")
+}
+
+// waitServerState 等待反向WebSocket服务进入指定状态
+func waitServerState(t *testing.T, server *connection.WSServer, state connection.State) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待状态 %s 超时, 当前 %s", state, server.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPConnection HTTP连接（HTTP POST接收事件 + HTTP调用API）
+type HTTPConnection struct {
+	stateMachine
+	frameRouter
+	config   *config.NapCatConfig
+	client   *http.Client
+	server   *http.Server
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewHTTPConnection 创建HTTP连接
+func NewHTTPConnection(cfg *config.NapCatConfig, handler func(*protocol.Event)) *HTTPConnection {
+	return &HTTPConnection{
+		config:      cfg,
+		frameRouter: newFrameRouter(cfg, handler),
+		client:      &http.Client{Timeout: 30 * time.Second},
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start 启动HTTP事件接收服务
+func (c *HTTPConnection) Start() error {
+	addr := fmt.Sprintf("%s:%d", c.config.ListenHost, c.config.ListenPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听失败: %v", err)
+	}
+
+	path := c.config.ListenPath
+	if path == "" {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, c.handleEvent)
+	c.server = &http.Server{Handler: mux}
+
+	utils.Info("HTTP事件接收服务已启动: http://%s%s", addr, path)
+
+	go func() {
+		if err := c.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			utils.Error("HTTP事件接收服务异常退出: %v", err)
+		}
+	}()
+
+	// HTTP为无状态连接，启动即视为已连接，无法主动重连，失活时只记录
+	c.watchdog.reset()
+	go c.watchdog.watch(c.stopChan, func(reason string) {
+		utils.Error("HTTP上报失活: %s，请检查NapCat", reason)
+	})
+	c.setState(StateConnected)
+
+	return nil
+}
+
+// handleEvent 处理NapCat上报的事件
+func (c *HTTPConnection) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+
+	if !c.checkSignature(r.Header.Get("X-Signature"), body) {
+		utils.Error("HTTP上报签名校验失败: %s", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if c.config.SelfID != 0 {
+		selfID, _ := strconv.ParseInt(r.Header.Get("X-Self-ID"), 10, 64)
+		if selfID != c.config.SelfID {
+			utils.Error("HTTP上报账号不匹配: 期望%d, 实际%d", c.config.SelfID, selfID)
+			http.Error(w, "unexpected X-Self-ID", http.StatusForbidden)
+			return
+		}
+	}
+
+	c.dispatch(body)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkSignature 校验HMAC-SHA1签名（格式: sha1=<hex>），未配置密钥时跳过
+func (c *HTTPConnection) checkSignature(signature string, body []byte) bool {
+	if c.config.Secret == "" {
+		return true
+	}
+
+	sig, ok := strings.CutPrefix(signature, "sha1=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, []byte(c.config.Secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// SendMessage 通过HTTP调用API，响应交给API响应处理器（调用方上下文取消或连接停止时中断请求）
+func (c *HTTPConnection) SendMessage(ctx context.Context, data []byte) error {
+	var req protocol.SendMessageReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("解析请求失败: %v", err)
+	}
+	c.recordOutbound(data)
+
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return fmt.Errorf("marshal params error: %v", err)
+	}
+
+	u := fmt.Sprintf("http://%s:%d/%s", c.config.Host, c.config.Port, req.Action)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(params))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("HTTP请求失败: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP状态码异常: %d, %s", httpResp.StatusCode, string(body))
+	}
+
+	var resp protocol.Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	// 补上echo后按普通响应帧处理（录制并交给等待中的调用）
+	resp.Echo = req.Echo
+	frame, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("marshal response error: %v", err)
+	}
+	c.dispatch(frame)
+	return nil
+}
+
+// Health 获取连接健康状态
+func (c *HTTPConnection) Health() Health {
+	return c.watchdog.snapshot(c.State())
+}
+
+// Stop 停止服务
+func (c *HTTPConnection) Stop() error {
+	c.setState(StateStopped)
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+	})
+
+	if c.server != nil {
+		return c.server.Close()
+	}
+	return nil
+}
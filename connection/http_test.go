@@ -0,0 +1,82 @@
+package connection_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"qq_bot/config"
+	"qq_bot/connection"
+	"qq_bot/protocol"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startHTTPConnection 创建指向假NapCat HTTP API的连接（API请求阻塞直到测试结束）
+func startHTTPConnection(t *testing.T) (*connection.HTTPConnection, *protocol.API) {
+	t.Helper()
+
+	release := make(chan struct{})
+	napcat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(napcat.Close)
+	t.Cleanup(func() { close(release) })
+
+	host, port, _ := net.SplitHostPort(napcat.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	conn := connection.NewHTTPConnection(&config.NapCatConfig{
+		Mode:              connection.ModeHTTP,
+		Host:              host,
+		Port:              portNum,
+		ListenHost:        "127.0.0.1",
+		HeartbeatInterval: 30000,
+	}, nil)
+	api := protocol.NewAPI(conn.SendMessage)
+	conn.SetResponseHandler(api.HandleResponse)
+	return conn, api
+}
+
+func TestHTTPCallHonorsContext(t *testing.T) {
+	_, api := startHTTPConnection(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := api.GetLoginInfo(ctx); err == nil {
+		t.Fatal("NapCat无响应时调用应失败")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("调用耗时 %s, 期望在上下文超时后立即返回", elapsed)
+	}
+}
+
+func TestHTTPStopCancelsCalls(t *testing.T) {
+	conn, api := startHTTPConnection(t)
+	if err := conn.Start(); err != nil {
+		t.Fatalf("启动HTTP连接失败: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := api.GetLoginInfo(context.Background())
+		errs <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	conn.Stop()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("连接停止后调用应失败")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("连接停止后进行中的调用未被取消")
+	}
+}
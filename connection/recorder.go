@@ -0,0 +1,110 @@
+package connection
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"qq_bot/utils"
+	"sync"
+	"time"
+)
+
+// 数据帧方向
+const (
+	DirectionIn  = "in"  // NapCat -> 机器人（事件、API响应）
+	DirectionOut = "out" // 机器人 -> NapCat（API请求）
+)
+
+// Frame 录制的数据帧
+type Frame struct {
+	Time      time.Time       `json:"time"`
+	SelfID    int64           `json:"self_id,omitempty"`
+	Direction string          `json:"direction"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Recorder 流量录制器，将收发的数据帧按JSONL格式写入文件
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewRecorder 创建录制器（追加写入）
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开录制文件失败: %v", err)
+	}
+	return &Recorder{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// Record 录制一个数据帧（nil录制器不做任何事）
+func (r *Recorder) Record(selfID int64, direction string, data []byte) {
+	if r == nil {
+		return
+	}
+
+	frame := Frame{
+		Time:      time.Now(),
+		SelfID:    selfID,
+		Direction: direction,
+		Data:      json.RawMessage(data),
+	}
+	if !json.Valid(data) {
+		// 非JSON数据按字符串保存，保证文件每行都可解析
+		quoted, _ := json.Marshal(string(data))
+		frame.Data = quoted
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(frame); err != nil {
+		utils.Error("录制数据帧失败: %v", err)
+	}
+}
+
+// Close 关闭录制文件
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// LoadRecording 读取录制文件
+func LoadRecording(path string) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开录制文件失败: %v", err)
+	}
+	defer file.Close()
+
+	frames := make([]Frame, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("解析录制文件第%d行失败: %v", line, err)
+		}
+		frames = append(frames, frame)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %v", err)
+	}
+	return frames, nil
+}
@@ -0,0 +1,179 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"sync"
+	"time"
+)
+
+// Replayer 回放连接：将录制的入站事件按顺序送入事件处理器，
+// 出站API请求由假发送器接收，并用录制中同名action的响应应答
+type Replayer struct {
+	stateMachine
+	frameRouter
+	frames   []Frame
+	speed    float64 // 回放速度倍率，0表示不等待
+	canned   map[string][]json.RawMessage
+	mu       sync.Mutex
+	sent     []protocol.SendMessageReq
+	msgSeq   int32
+	done     chan struct{}
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReplayer 创建回放连接
+func NewReplayer(cfg *config.NapCatConfig, frames []Frame, speed float64, handler func(*protocol.Event)) *Replayer {
+	r := &Replayer{
+		frameRouter: newFrameRouter(cfg, handler),
+		frames:      frames,
+		speed:       speed,
+		canned:      make(map[string][]json.RawMessage),
+		done:        make(chan struct{}),
+		stopChan:    make(chan struct{}),
+	}
+	r.buildCannedResponses()
+	return r
+}
+
+// buildCannedResponses 根据echo关联录制中的请求和响应，按action整理出响应数据
+func (r *Replayer) buildCannedResponses() {
+	actions := make(map[string]string) // echo -> action
+	for _, frame := range r.frames {
+		if frame.Direction == DirectionOut {
+			var req protocol.SendMessageReq
+			if json.Unmarshal(frame.Data, &req) == nil && req.Echo != "" {
+				actions[req.Echo] = req.Action
+			}
+			continue
+		}
+
+		_, resp, err := protocol.ParseFrame(frame.Data)
+		if err != nil || resp == nil {
+			continue
+		}
+		if action, ok := actions[resp.Echo]; ok && resp.RetCode == 0 {
+			r.canned[action] = append(r.canned[action], resp.Data)
+		}
+	}
+}
+
+// Start 开始回放
+func (r *Replayer) Start() error {
+	r.watchdog.reset()
+	r.setState(StateConnected)
+	go r.run()
+	return nil
+}
+
+// run 按顺序回放入站事件
+func (r *Replayer) run() {
+	defer close(r.done)
+
+	var last time.Time
+	count := 0
+	for _, frame := range r.frames {
+		if frame.Direction != DirectionIn {
+			continue
+		}
+		if _, resp, err := protocol.ParseFrame(frame.Data); err != nil || resp != nil {
+			continue
+		}
+
+		// 按录制时间间隔回放
+		if r.speed > 0 && !last.IsZero() {
+			wait := time.Duration(float64(frame.Time.Sub(last)) / r.speed)
+			select {
+			case <-time.After(wait):
+			case <-r.stopChan:
+				return
+			}
+		}
+		last = frame.Time
+
+		select {
+		case <-r.stopChan:
+			return
+		default:
+		}
+
+		r.dispatch(frame.Data)
+		count++
+	}
+
+	utils.Info("回放完成: self_id=%d, 共%d个事件", r.selfID.Load(), count)
+}
+
+// SendMessage 假发送器：记录请求并立即应答
+func (r *Replayer) SendMessage(ctx context.Context, data []byte) error {
+	var req protocol.SendMessageReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.sent = append(r.sent, req)
+	respData := r.cannedResponse(req.Action)
+	r.mu.Unlock()
+
+	utils.Info("[回放] 发出请求: %s", string(data))
+
+	if r.responseHandler != nil && req.Echo != "" {
+		r.responseHandler(&protocol.Response{
+			Status:  "ok",
+			RetCode: 0,
+			Data:    respData,
+			Echo:    req.Echo,
+		})
+	}
+	return nil
+}
+
+// cannedResponse 获取action的应答数据（调用方持有锁）
+func (r *Replayer) cannedResponse(action string) json.RawMessage {
+	switch action {
+	case "send_private_msg", "send_group_msg", "send_msg":
+		r.msgSeq++
+		data, _ := json.Marshal(protocol.SendMessageResult{MessageID: r.msgSeq})
+		return data
+	}
+
+	if list := r.canned[action]; len(list) > 0 {
+		data := list[0]
+		if len(list) > 1 {
+			r.canned[action] = list[1:]
+		}
+		return data
+	}
+	return json.RawMessage("{}")
+}
+
+// Sent 获取回放期间发出的全部请求
+func (r *Replayer) Sent() []protocol.SendMessageReq {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]protocol.SendMessageReq(nil), r.sent...)
+}
+
+// Done 回放结束时关闭
+func (r *Replayer) Done() <-chan struct{} {
+	return r.done
+}
+
+// Health 获取连接健康状态
+func (r *Replayer) Health() Health {
+	return r.watchdog.snapshot(r.State())
+}
+
+// Stop 停止回放
+func (r *Replayer) Stop() error {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+	r.setState(StateStopped)
+	return nil
+}
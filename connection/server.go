@@ -0,0 +1,214 @@
+package connection
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSServer 反向WebSocket服务端（由NapCat主动连接）
+type WSServer struct {
+	stateMachine
+	frameRouter
+	conn     *websocket.Conn
+	config   *config.NapCatConfig
+	server   *http.Server
+	upgrader websocket.Upgrader
+	mu       sync.Mutex
+}
+
+// NewWSServer 创建反向WebSocket服务端
+func NewWSServer(cfg *config.NapCatConfig, handler func(*protocol.Event)) *WSServer {
+	return &WSServer{
+		config:      cfg,
+		frameRouter: newFrameRouter(cfg, handler),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// Start 启动监听
+func (s *WSServer) Start() error {
+	addr := fmt.Sprintf("%s:%d", s.config.ListenHost, s.config.ListenPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听失败: %v", err)
+	}
+
+	path := s.config.ListenPath
+	if path == "" {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, s)
+	s.server = &http.Server{Handler: mux}
+
+	utils.Info("反向WebSocket服务已启动: ws://%s%s", addr, path)
+	s.setState(StateConnecting)
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			utils.Error("反向WebSocket服务异常退出: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// ServeHTTP 处理NapCat的连接请求
+func (s *WSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(r) {
+		utils.Error("反向WebSocket鉴权失败: %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	selfID, err := strconv.ParseInt(r.Header.Get("X-Self-ID"), 10, 64)
+	if err != nil || selfID == 0 {
+		utils.Error("反向WebSocket缺少有效的X-Self-ID: %s", r.RemoteAddr)
+		http.Error(w, "invalid X-Self-ID", http.StatusBadRequest)
+		return
+	}
+	if s.config.SelfID != 0 && selfID != s.config.SelfID {
+		utils.Error("反向WebSocket账号不匹配: 期望%d, 实际%d", s.config.SelfID, selfID)
+		http.Error(w, "unexpected X-Self-ID", http.StatusForbidden)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		utils.Error("反向WebSocket升级失败: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	old := s.conn
+	s.conn = conn
+	s.frameRouter.selfID.Store(selfID) // 录制和回放按实际连接的账号归属
+	s.mu.Unlock()
+
+	// 同一时间只保留一个连接，新连接替换旧连接
+	if old != nil {
+		old.Close()
+	}
+	s.watchdog.reset()
+	s.setState(StateConnected)
+
+	utils.Info("NapCat已连接: self_id=%d, role=%s, remote=%s",
+		selfID, r.Header.Get("X-Client-Role"), r.RemoteAddr)
+
+	s.readMessages(conn)
+}
+
+// checkToken 校验访问令牌（支持Authorization头和access_token参数）
+func (s *WSServer) checkToken(r *http.Request) bool {
+	if s.config.Token == "" {
+		return true
+	}
+
+	token := r.URL.Query().Get("access_token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token = strings.TrimSpace(auth)
+		for _, prefix := range []string{"Bearer ", "Token "} {
+			if strings.HasPrefix(token, prefix) {
+				token = strings.TrimSpace(strings.TrimPrefix(token, prefix))
+				break
+			}
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) == 1
+}
+
+// readMessages 读取消息
+func (s *WSServer) readMessages(conn *websocket.Conn) {
+	done := make(chan struct{})
+	go s.watchdog.watch(done, func(reason string) {
+		// 关闭连接后NapCat会自动重连
+		utils.Error("反向WebSocket连接失活: %s，关闭连接等待重连", reason)
+		conn.Close()
+	})
+
+	defer func() {
+		close(done)
+
+		s.mu.Lock()
+		current := s.conn == conn
+		if current {
+			s.conn = nil
+		}
+		s.mu.Unlock()
+		conn.Close()
+
+		// 等待NapCat重新连接
+		if current {
+			s.setState(StateConnecting)
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			utils.Error("反向WebSocket读取消息错误: %v", err)
+			return
+		}
+
+		s.dispatch(message)
+	}
+}
+
+// SendMessage 发送消息
+func (s *WSServer) SendMessage(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return fmt.Errorf("NapCat未连接")
+	}
+
+	s.recordOutbound(data)
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Stop 停止服务
+func (s *WSServer) Stop() error {
+	s.setState(StateStopped)
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+
+	if s.server != nil {
+		return s.server.Close()
+	}
+	return nil
+}
+
+// Health 获取连接健康状态
+func (s *WSServer) Health() Health {
+	return s.watchdog.snapshot(s.State())
+}
+
+// SelfID 获取当前连接的机器人QQ号
+func (s *WSServer) SelfID() int64 {
+	return s.frameRouter.selfID.Load()
+}
@@ -0,0 +1,122 @@
+package connection
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// State 连接状态
+type State int
+
+const (
+	StateConnecting State = iota // 连接中（反向/HTTP模式表示等待NapCat连接）
+	StateConnected               // 已连接
+	StateBackingOff              // 连接失败，等待重试
+	StateStopped                 // 已停止
+)
+
+// String 状态名称
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateBackingOff:
+		return "backing-off"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// StateListener 状态变更回调（同步调用，不应阻塞）
+type StateListener func(oldState, newState State)
+
+// stateMachine 连接状态机，供各连接实现内嵌
+type stateMachine struct {
+	stateMu   sync.Mutex
+	state     State
+	listeners []StateListener
+}
+
+// State 获取当前状态
+func (m *stateMachine) State() State {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.state
+}
+
+// OnStateChange 订阅状态变更
+func (m *stateMachine) OnStateChange(listener StateListener) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// IsRunning 检查是否已连接
+func (m *stateMachine) IsRunning() bool {
+	return m.State() == StateConnected
+}
+
+// setState 切换状态并通知订阅者，已停止后不再切换
+func (m *stateMachine) setState(state State) {
+	m.stateMu.Lock()
+	old := m.state
+	if old == state || old == StateStopped {
+		m.stateMu.Unlock()
+		return
+	}
+	m.state = state
+	listeners := append([]StateListener(nil), m.listeners...)
+	m.stateMu.Unlock()
+
+	for _, listener := range listeners {
+		listener(old, state)
+	}
+}
+
+// backoff 指数退避（带随机抖动）
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	jitter  float64 // 抖动比例 0-1
+	attempt int
+}
+
+// newBackoff 创建指数退避
+func newBackoff(initial, max time.Duration) *backoff {
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+	if max < initial {
+		max = initial
+	}
+	return &backoff{initial: initial, max: max, jitter: 0.2}
+}
+
+// Next 获取下一次重试的等待时间
+func (b *backoff) Next() time.Duration {
+	delay := b.initial
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	b.attempt++
+
+	// 在 [1-jitter, 1+jitter] 范围内随机抖动，避免多个实例同时重连
+	factor := 1 + b.jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// Reset 连接成功后重置
+func (b *backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,170 @@
+package connection
+
+import (
+	"fmt"
+	"qq_bot/protocol"
+	"sync"
+	"time"
+)
+
+// Health 连接健康状态
+type Health struct {
+	State             State         `json:"state"`
+	Alive             bool          `json:"alive"`              // 链路是否存活
+	Online            bool          `json:"online"`             // NapCat上报的QQ在线状态
+	LastFrame         time.Time     `json:"last_frame"`         // 最后收到任意数据帧的时间
+	LastHeartbeat     time.Time     `json:"last_heartbeat"`     // 最后收到心跳事件的时间
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"` // 心跳间隔（来自心跳事件）
+	Reason            string        `json:"reason,omitempty"`   // 判定失活的原因
+}
+
+// watchdog 死链检测：按心跳间隔判断是否长时间未收到任何数据帧，并处理心跳上报的离线状态
+type watchdog struct {
+	mu            sync.Mutex
+	maxMissed     int           // 允许连续错过的心跳次数
+	fallback      time.Duration // 尚未收到心跳事件时使用的间隔
+	connectedAt   time.Time
+	lastFrame     time.Time
+	lastHeartbeat time.Time
+	interval      time.Duration
+	online        bool
+	alive         bool
+	reason        string
+	pending       string // 待处理的失活原因（如心跳上报离线）
+}
+
+// newWatchdog 创建死链检测器
+func newWatchdog(maxMissed int, fallback time.Duration) *watchdog {
+	if maxMissed <= 0 {
+		maxMissed = 3
+	}
+	return &watchdog{
+		maxMissed: maxMissed,
+		fallback:  fallback,
+	}
+}
+
+// reset 新连接建立时重置
+func (w *watchdog) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.connectedAt = now
+	w.lastFrame = now
+	w.lastHeartbeat = time.Time{}
+	w.interval = 0
+	w.online = true
+	w.alive = true
+	w.reason = ""
+	w.pending = ""
+}
+
+// touch 收到任意数据帧，QQ在线时恢复因超时判定的失活
+func (w *watchdog) touch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastFrame = time.Now()
+	if w.online {
+		w.revive()
+	}
+}
+
+// revive 恢复存活状态（不重连的连接在数据恢复后依赖此处恢复），调用方需持有锁
+func (w *watchdog) revive() {
+	w.alive = true
+	w.reason = ""
+}
+
+// observe 处理心跳元事件，记录间隔和在线状态
+func (w *watchdog) observe(e *protocol.Event) {
+	heartbeat, ok := e.Typed().(protocol.HeartbeatMetaEvent)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastHeartbeat = time.Now()
+	if heartbeat.Interval > 0 {
+		w.interval = time.Duration(heartbeat.Interval) * time.Millisecond
+	}
+
+	w.online = heartbeat.Online()
+	if !w.online {
+		w.pending = "心跳上报QQ离线(online=false)"
+		return
+	}
+	w.pending = ""
+	w.revive()
+}
+
+// check 检查是否失活，返回新判定的失活原因
+func (w *watchdog) check(now time.Time) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.alive {
+		return "", false
+	}
+
+	reason := w.pending
+	if reason == "" {
+		interval := w.interval
+		if interval <= 0 {
+			interval = w.fallback
+		}
+		// 任意数据帧都说明链路可用，NapCat关闭心跳时也不会误判
+		last := w.lastFrame
+		if last.IsZero() {
+			last = w.connectedAt
+		}
+		if interval > 0 && now.Sub(last) > time.Duration(w.maxMissed)*interval {
+			reason = fmt.Sprintf("连续%d个心跳周期(%v)未收到任何数据", w.maxMissed, interval)
+		}
+	}
+
+	if reason == "" {
+		return "", false
+	}
+
+	w.alive = false
+	w.reason = reason
+	w.pending = ""
+	return reason, true
+}
+
+// watch 定期检查链路，失活时调用kill，直到done关闭
+func (w *watchdog) watch(done <-chan struct{}, kill func(reason string)) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if reason, dead := w.check(now); dead {
+				kill(reason)
+			}
+		}
+	}
+}
+
+// snapshot 获取健康状态快照
+func (w *watchdog) snapshot(state State) Health {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return Health{
+		State:             state,
+		Alive:             w.alive && state == StateConnected,
+		Online:            w.online,
+		LastFrame:         w.lastFrame,
+		LastHeartbeat:     w.lastHeartbeat,
+		HeartbeatInterval: w.interval,
+		Reason:            w.reason,
+	}
+}
@@ -1,7 +1,7 @@
 package connection
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/url"
 	"qq_bot/config"
@@ -15,30 +15,31 @@ import (
 
 // WSClient WebSocket客户端
 type WSClient struct {
-	conn              *websocket.Conn
-	config            *config.NapCatConfig
-	messageHandler    func(*protocol.Event)
-	reconnectInterval time.Duration
-	mu                sync.Mutex
-	isRunning         bool
-	stopChan          chan struct{}
+	stateMachine
+	frameRouter
+	conn     *websocket.Conn
+	config   *config.NapCatConfig
+	backoff  *backoff
+	mu       sync.Mutex
+	stopChan chan struct{}
+	stopOnce sync.Once
 }
 
 // NewWSClient 创建WebSocket客户端
 func NewWSClient(cfg *config.NapCatConfig, handler func(*protocol.Event)) *WSClient {
 	return &WSClient{
-		config:            cfg,
-		messageHandler:    handler,
-		reconnectInterval: 5 * time.Second,
-		stopChan:          make(chan struct{}),
+		config:      cfg,
+		frameRouter: newFrameRouter(cfg, handler),
+		backoff: newBackoff(
+			time.Duration(cfg.ReconnectInterval)*time.Millisecond,
+			time.Duration(cfg.ReconnectMaxInterval)*time.Millisecond,
+		),
+		stopChan: make(chan struct{}),
 	}
 }
 
-// Connect 连接到WebSocket服务器
-func (c *WSClient) Connect() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
+// dial 连接到WebSocket服务器
+func (c *WSClient) dial() (*websocket.Conn, error) {
 	u := url.URL{
 		Scheme: "ws",
 		Host:   fmt.Sprintf("%s:%d", c.config.Host, c.config.Port),
@@ -55,67 +56,108 @@ func (c *WSClient) Connect() error {
 
 	conn, _, err := websocket.DefaultDialer.Dial(u.String(), header)
 	if err != nil {
-		return fmt.Errorf("连接失败: %v", err)
+		return nil, fmt.Errorf("连接失败: %v", err)
 	}
+	return conn, nil
+}
 
-	c.conn = conn
-	c.isRunning = true
-	utils.Info("WebSocket连接成功")
-
+// Start 启动客户端（后台连接，NapCat未启动时按退避策略重试）
+func (c *WSClient) Start() error {
+	go c.run()
 	return nil
 }
 
-// Start 启动客户端（包含自动重连）
-func (c *WSClient) Start() error {
-	if err := c.Connect(); err != nil {
-		return err
-	}
+// run 连接主循环：连接 -> 读取 -> 断开后退避重连
+func (c *WSClient) run() {
+	for {
+		if c.stopped() {
+			return
+		}
 
-	go c.heartbeat()
-	go c.readMessages()
+		c.setState(StateConnecting)
+		conn, err := c.dial()
+		if err != nil {
+			utils.Error("%v", err)
+			if !c.waitBackoff() {
+				return
+			}
+			continue
+		}
 
-	return nil
-}
+		c.backoff.Reset()
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+
+		utils.Info("WebSocket连接成功")
+		c.watchdog.reset()
+		c.setState(StateConnected)
+
+		c.serve(conn)
 
-// readMessages 读取消息
-func (c *WSClient) readMessages() {
-	defer func() {
 		c.mu.Lock()
-		c.isRunning = false
+		if c.conn == conn {
+			c.conn = nil
+		}
 		c.mu.Unlock()
-	}()
 
-	for {
-		select {
-		case <-c.stopChan:
-			utils.Info("停止读取消息")
+		if c.stopped() {
 			return
-		default:
-			_, message, err := c.conn.ReadMessage()
-			if err != nil {
-				utils.Error("读取消息错误: %v", err)
-				// 尝试重连
-				c.reconnect()
-				return
-			}
+		}
+		if !c.waitBackoff() {
+			return
+		}
+	}
+}
 
-			// 解析事件
-			var event protocol.Event
-			if err := json.Unmarshal(message, &event); err != nil {
-				utils.Error("解析事件错误: %v, 原始数据: %s", err, string(message))
-				continue
-			}
+// serve 处理单个连接，直到连接断开
+func (c *WSClient) serve(conn *websocket.Conn) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go c.heartbeat(conn, done)
+	go c.watchdog.watch(done, func(reason string) {
+		utils.Error("连接失活: %s，强制重连", reason)
+		conn.Close()
+	})
 
-			// 处理事件
-			if c.messageHandler != nil {
-				go c.messageHandler(&event)
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if !c.stopped() {
+				utils.Error("读取消息错误: %v", err)
 			}
+			conn.Close()
+			return
 		}
+
+		c.dispatch(message)
+	}
+}
+
+// waitBackoff 进入退避状态并等待，返回false表示已停止
+func (c *WSClient) waitBackoff() bool {
+	delay := c.backoff.Next()
+	c.setState(StateBackingOff)
+	utils.Info("%.1f秒后尝试重新连接...", delay.Seconds())
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-c.stopChan:
+		return false
+	case <-timer.C:
+		return true
 	}
 }
 
 // SendMessage 发送消息
-func (c *WSClient) SendMessage(data []byte) error {
+func (c *WSClient) SendMessage(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -123,71 +165,65 @@ func (c *WSClient) SendMessage(data []byte) error {
 		return fmt.Errorf("websocket未连接")
 	}
 
+	c.recordOutbound(data)
 	return c.conn.WriteMessage(websocket.TextMessage, data)
 }
 
-// heartbeat 心跳保持
-func (c *WSClient) heartbeat() {
-	ticker := time.NewTicker(time.Duration(c.config.HeartbeatInterval) * time.Millisecond)
+// heartbeat 心跳保持（绑定到单个连接，连接结束时退出）
+func (c *WSClient) heartbeat(conn *websocket.Conn, done <-chan struct{}) {
+	interval := time.Duration(c.config.HeartbeatInterval) * time.Millisecond
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-c.stopChan:
+		case <-done:
 			return
 		case <-ticker.C:
 			c.mu.Lock()
-			if c.conn != nil {
-				// 发送心跳包
-				err := c.conn.WriteMessage(websocket.PingMessage, []byte{})
-				if err != nil {
-					utils.Error("心跳发送失败: %v", err)
-				}
-			}
+			// 发送心跳包
+			err := conn.WriteMessage(websocket.PingMessage, []byte{})
 			c.mu.Unlock()
+			if err != nil {
+				utils.Error("心跳发送失败: %v", err)
+			}
 		}
 	}
 }
 
-// reconnect 重连
-func (c *WSClient) reconnect() {
-	utils.Info("尝试重新连接...")
-
-	for {
-		select {
-		case <-c.stopChan:
-			return
-		default:
-			time.Sleep(c.reconnectInterval)
-
-			if err := c.Connect(); err != nil {
-				utils.Error("重连失败: %v", err)
-				continue
-			}
+// Health 获取连接健康状态
+func (c *WSClient) Health() Health {
+	return c.watchdog.snapshot(c.State())
+}
 
-			utils.Info("重连成功")
-			go c.readMessages()
-			return
-		}
+// stopped 检查是否已停止
+func (c *WSClient) stopped() bool {
+	select {
+	case <-c.stopChan:
+		return true
+	default:
+		return false
 	}
 }
 
 // Stop 停止客户端
 func (c *WSClient) Stop() error {
-	close(c.stopChan)
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+	})
+	c.setState(StateStopped)
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.conn != nil {
-		return c.conn.Close()
+		err := c.conn.Close()
+		c.conn = nil
+		return err
 	}
 	return nil
 }
-
-// IsRunning 检查是否运行中
-func (c *WSClient) IsRunning() bool {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.isRunning
-}
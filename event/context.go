@@ -0,0 +1,29 @@
+package event
+
+import (
+	"context"
+)
+
+type rootKey struct{}
+
+// WithRoot 记录根上下文（关闭时取消），Detach 派生的上下文随其取消
+func WithRoot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rootKey{}, ctx)
+}
+
+// Detach 派生脱离当前事件期限的上下文，用于处理函数返回后仍需继续的后台任务
+// 保留追踪ID等值，不受事件超时影响，但在根上下文取消（程序关闭）时取消
+func Detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	root, ok := ctx.Value(rootKey{}).(context.Context)
+	if !ok {
+		return detached, cancel
+	}
+
+	stop := context.AfterFunc(root, cancel)
+	return detached, func() {
+		stop()
+		cancel()
+	}
+}
@@ -1,20 +1,68 @@
 package event
 
 import (
+	"context"
 	"qq_bot/protocol"
 	"qq_bot/utils"
+	"sort"
+	"sync"
+	"time"
 )
 
-// HandlerFunc 事件处理函数
-type HandlerFunc func(*protocol.Event)
+// DefaultPriority 默认优先级（OnMessage等注册的处理器使用）
+const DefaultPriority = 100
+
+// FallbackPriority 兜底优先级（AI对话等处理剩余消息的规则使用）
+const FallbackPriority = 1000
+
+// DefaultTimeout 单个事件默认处理超时
+const DefaultTimeout = 2 * time.Minute
+
+// HandlerFunc 事件处理函数，ctx 带有事件期限和追踪ID，程序关闭时取消
+type HandlerFunc func(context.Context, *protocol.Event)
+
+// RuleHandler 规则处理函数，返回true表示停止传播
+type RuleHandler func(context.Context, *protocol.Event) bool
+
+// Rule 处理规则：匹配器 + 处理函数 + 优先级
+type Rule struct {
+	name     string
+	matcher  Matcher
+	handler  RuleHandler
+	priority int
+	block    bool
+	seq      int // 注册顺序，同优先级按注册顺序执行
+}
+
+// Priority 设置优先级（数值越小越先执行）
+func (r *Rule) Priority(priority int) *Rule {
+	r.priority = priority
+	return r
+}
+
+// Block 匹配后总是停止传播
+func (r *Rule) Block() *Rule {
+	r.block = true
+	return r
+}
+
+// Name 设置规则名称（用于日志）
+func (r *Rule) Name(name string) *Rule {
+	r.name = name
+	return r
+}
 
 // Dispatcher 事件分发器
 type Dispatcher struct {
-	messageHandlers []HandlerFunc
-	noticeHandlers  []HandlerFunc
-	requestHandlers []HandlerFunc
-	metaHandlers    []HandlerFunc
-	middlewares     []MiddlewareFunc
+	mu          sync.RWMutex
+	rules       []*Rule
+	sorted      bool
+	middlewares []MiddlewareFunc
+	waiters     []*waiter                    // 等待下一条事件的会话
+	subs        []*Subscription              // 持续接收事件的会话订阅
+	queued      map[string][]*protocol.Event // 已进入处理池、尚未开始处理的事件（订阅时可认领）
+	claimed     map[*protocol.Event]bool     // 已被订阅认领的排队事件，轮到处理时跳过
+	timeout     time.Duration
 }
 
 // MiddlewareFunc 中间件函数
@@ -23,72 +71,164 @@ type MiddlewareFunc func(*protocol.Event, HandlerFunc) HandlerFunc
 // NewDispatcher 创建事件分发器
 func NewDispatcher() *Dispatcher {
 	return &Dispatcher{
-		messageHandlers: make([]HandlerFunc, 0),
-		noticeHandlers:  make([]HandlerFunc, 0),
-		requestHandlers: make([]HandlerFunc, 0),
-		metaHandlers:    make([]HandlerFunc, 0),
-		middlewares:     make([]MiddlewareFunc, 0),
+		rules:       make([]*Rule, 0),
+		middlewares: make([]MiddlewareFunc, 0),
+		queued:      make(map[string][]*protocol.Event),
+		claimed:     make(map[*protocol.Event]bool),
+		timeout:     DefaultTimeout,
+	}
+}
+
+// SetTimeout 设置单个事件的处理超时（<=0 使用默认值）
+func (d *Dispatcher) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
 	}
+	d.timeout = timeout
+}
+
+// Handle 注册处理规则，返回的Rule可继续设置优先级和阻断
+func (d *Dispatcher) Handle(matcher Matcher, handler RuleHandler) *Rule {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rule := &Rule{
+		matcher:  matcher,
+		handler:  handler,
+		priority: DefaultPriority,
+		seq:      len(d.rules),
+	}
+	d.rules = append(d.rules, rule)
+	d.sorted = false
+	return rule
 }
 
 // OnMessage 注册消息事件处理器
 func (d *Dispatcher) OnMessage(handler HandlerFunc) {
-	d.messageHandlers = append(d.messageHandlers, handler)
+	d.Handle(PostType("message"), passThrough(handler))
 }
 
 // OnNotice 注册通知事件处理器
 func (d *Dispatcher) OnNotice(handler HandlerFunc) {
-	d.noticeHandlers = append(d.noticeHandlers, handler)
+	d.Handle(PostType("notice"), passThrough(handler))
 }
 
 // OnRequest 注册请求事件处理器
 func (d *Dispatcher) OnRequest(handler HandlerFunc) {
-	d.requestHandlers = append(d.requestHandlers, handler)
+	d.Handle(PostType("request"), passThrough(handler))
 }
 
 // OnMeta 注册元事件处理器
 func (d *Dispatcher) OnMeta(handler HandlerFunc) {
-	d.metaHandlers = append(d.metaHandlers, handler)
+	d.Handle(PostType("meta_event"), passThrough(handler))
+}
+
+// On 注册具体类型的事件处理器，T必须是 protocol 中的具体事件类型，例如:
+//
+//	event.On(d, func(ctx context.Context, e protocol.PokeNotice) { ... })
+func On[T protocol.TypedEvent](d *Dispatcher, handler func(context.Context, T)) *Rule {
+	var zero T
+	return d.Handle(EventName(zero.EventName()), func(ctx context.Context, e *protocol.Event) bool {
+		if typed, ok := e.Typed().(T); ok {
+			handler(ctx, typed)
+		}
+		return false
+	})
 }
 
 // Use 使用中间件
 func (d *Dispatcher) Use(middleware MiddlewareFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	d.middlewares = append(d.middlewares, middleware)
 }
 
-// Dispatch 分发事件
-func (d *Dispatcher) Dispatch(event *protocol.Event) {
+// snapshot 获取按优先级排序的规则和中间件
+func (d *Dispatcher) snapshot() ([]*Rule, []MiddlewareFunc) {
+	d.mu.RLock()
+	if d.sorted {
+		defer d.mu.RUnlock()
+		return d.rules, d.middlewares
+	}
+	d.mu.RUnlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.sorted {
+		rules := append([]*Rule(nil), d.rules...)
+		sort.SliceStable(rules, func(i, j int) bool {
+			if rules[i].priority != rules[j].priority {
+				return rules[i].priority < rules[j].priority
+			}
+			return rules[i].seq < rules[j].seq
+		})
+		d.rules = rules
+		d.sorted = true
+	}
+	return d.rules, d.middlewares
+}
+
+// Dispatch 分发事件：按优先级依次执行匹配的规则，直到某个规则停止传播
+// ctx 为根上下文，分发时附加追踪ID和处理期限
+func (d *Dispatcher) Dispatch(ctx context.Context, event *protocol.Event) {
 	if event == nil {
 		return
 	}
+	if !d.dequeue(event) {
+		utils.Debug("事件已由会话订阅处理: %s", SessionKey(event))
+		return
+	}
+
+	if utils.TraceID(ctx) == "" {
+		ctx = utils.WithTrace(ctx, utils.NewTraceID())
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
 
-	utils.Debug("收到事件: post_type=%s, message_type=%s, notice_type=%s",
+	log := utils.Log(ctx)
+	log.Debug("收到事件: post_type=%s, message_type=%s, notice_type=%s",
 		event.PostType, event.MessageType, event.NoticeType)
 
-	var handlers []HandlerFunc
-
-	// 根据事件类型选择处理器
-	switch event.PostType {
-	case "message":
-		handlers = d.messageHandlers
-	case "notice":
-		handlers = d.noticeHandlers
-	case "request":
-		handlers = d.requestHandlers
-	case "meta_event":
-		handlers = d.metaHandlers
-	default:
-		utils.Debug("未知事件类型: %s", event.PostType)
-		return
-	}
+	rules, middlewares := d.snapshot()
 
-	// 执行处理器
-	for _, handler := range handlers {
-		finalHandler := handler
+	matched := false
+	for _, rule := range rules {
+		if ctx.Err() != nil {
+			log.Debug("事件处理已取消: %v", ctx.Err())
+			return
+		}
+		if !rule.matcher(event) {
+			continue
+		}
+		matched = true
+
+		stop := false
+		var finalHandler HandlerFunc = func(ctx context.Context, e *protocol.Event) {
+			stop = rule.handler(ctx, e)
+		}
 		// 应用中间件（逆序）
-		for i := len(d.middlewares) - 1; i >= 0; i-- {
-			finalHandler = d.middlewares[i](event, finalHandler)
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			finalHandler = middlewares[i](event, finalHandler)
+		}
+		finalHandler(ctx, event)
+
+		if stop || rule.block {
+			if rule.name != "" {
+				log.Debug("规则 [%s] 停止了事件传播", rule.name)
+			}
+			break
 		}
-		finalHandler(event)
+	}
+
+	if !matched {
+		log.Debug("没有匹配的处理器: %s", event.Typed().EventName())
+	}
+}
+
+// passThrough 将普通处理函数包装为不阻断的规则处理函数
+func passThrough(handler HandlerFunc) RuleHandler {
+	return func(ctx context.Context, e *protocol.Event) bool {
+		handler(ctx, e)
+		return false
 	}
 }
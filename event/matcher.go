@@ -0,0 +1,183 @@
+package event
+
+import (
+	"qq_bot/protocol"
+	"regexp"
+	"strings"
+)
+
+// Matcher 事件匹配器
+type Matcher func(*protocol.Event) bool
+
+// All 全部匹配
+func All(matchers ...Matcher) Matcher {
+	return func(e *protocol.Event) bool {
+		for _, m := range matchers {
+			if !m(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any 任一匹配
+func Any(matchers ...Matcher) Matcher {
+	return func(e *protocol.Event) bool {
+		for _, m := range matchers {
+			if m(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not 取反
+func Not(matcher Matcher) Matcher {
+	return func(e *protocol.Event) bool {
+		return !matcher(e)
+	}
+}
+
+// Always 匹配所有事件
+func Always() Matcher {
+	return func(e *protocol.Event) bool { return true }
+}
+
+// PostType 匹配上报类型
+func PostType(postType string) Matcher {
+	return func(e *protocol.Event) bool {
+		return e.PostType == postType
+	}
+}
+
+// EventName 匹配具体事件类型（见 protocol.TypedEvent）
+func EventName(name string) Matcher {
+	return func(e *protocol.Event) bool {
+		return e.Typed().EventName() == name
+	}
+}
+
+// IsMessage 匹配消息事件
+func IsMessage() Matcher {
+	return PostType("message")
+}
+
+// MessageType 匹配消息类型 private/group
+func MessageType(types ...string) Matcher {
+	return func(e *protocol.Event) bool {
+		if e.PostType != "message" {
+			return false
+		}
+		for _, t := range types {
+			if e.MessageType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Private 匹配私聊消息
+func Private() Matcher {
+	return MessageType("private")
+}
+
+// Group 匹配群消息
+func Group() Matcher {
+	return MessageType("group")
+}
+
+// GroupID 匹配群号
+func GroupID(ids ...int64) Matcher {
+	return func(e *protocol.Event) bool {
+		return containsID(ids, e.GroupID)
+	}
+}
+
+// UserID 匹配用户QQ号
+func UserID(ids ...int64) Matcher {
+	return func(e *protocol.Event) bool {
+		return containsID(ids, e.UserID)
+	}
+}
+
+// Prefix 匹配消息文本前缀
+func Prefix(prefixes ...string) Matcher {
+	return func(e *protocol.Event) bool {
+		text := MessageText(e)
+		for _, p := range prefixes {
+			if strings.HasPrefix(text, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Keyword 匹配消息文本包含任一关键词
+func Keyword(keywords ...string) Matcher {
+	return func(e *protocol.Event) bool {
+		text := MessageText(e)
+		for _, k := range keywords {
+			if strings.Contains(text, k) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Regex 匹配消息文本正则（pattern无效时panic，应在启动时注册）
+func Regex(pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return func(e *protocol.Event) bool {
+		return re.MatchString(MessageText(e))
+	}
+}
+
+// Mentioned 匹配@了机器人的消息
+func Mentioned() Matcher {
+	return func(e *protocol.Event) bool {
+		return e.PostType == "message" && e.Segments().Mentions(e.SelfID)
+	}
+}
+
+// ToMe 匹配对机器人说的消息（私聊或群内@机器人）
+func ToMe() Matcher {
+	return Any(Private(), Mentioned())
+}
+
+// SenderRole 匹配群内发送者角色 owner/admin/member
+func SenderRole(roles ...string) Matcher {
+	return func(e *protocol.Event) bool {
+		if e.Sender == nil {
+			return false
+		}
+		for _, r := range roles {
+			if e.Sender.Role == r {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MessageText 消息的纯文本内容（去除首尾空白）
+func MessageText(e *protocol.Event) string {
+	if e.PostType != "message" {
+		return ""
+	}
+	return strings.TrimSpace(e.Segments().PlainText())
+}
+
+// containsID 检查ID列表
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
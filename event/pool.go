@@ -0,0 +1,223 @@
+package event
+
+import (
+	"fmt"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"sync"
+)
+
+// 队列溢出策略
+const (
+	OverflowDropNewest = "drop_newest" // 丢弃新事件
+	OverflowDropOldest = "drop_oldest" // 丢弃该会话最旧的排队事件
+	OverflowBlock      = "block"       // 在提交队列中等待空位（不阻塞连接读取，提交队列也满时丢弃新事件）
+)
+
+// Pool 事件处理池：同一会话的事件串行处理，不同会话并行处理
+type Pool struct {
+	sem        chan struct{} // 并发上限
+	queueSize  int           // 单会话排队上限
+	maxPending int           // 全局排队上限
+	overflow   string
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queues     map[string]*taskQueue
+	pending    int
+	wg         sync.WaitGroup
+	backlog    chan submission // block策略下的提交队列，由单独的goroutine等待空位
+	fed        chan struct{}   // 提交goroutine退出时关闭
+	stopped    bool
+}
+
+// submission 等待提交的任务
+type submission struct {
+	key  string
+	task func()
+}
+
+// taskQueue 单个会话的任务队列
+type taskQueue struct {
+	tasks []func()
+}
+
+// NewPool 创建事件处理池
+func NewPool(cfg *config.DispatchConfig) *Pool {
+	if cfg == nil {
+		cfg = config.GetDefault().Dispatch
+	}
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 16
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 32
+	}
+	maxPending := cfg.MaxPending
+	if maxPending <= 0 {
+		maxPending = 1024
+	}
+
+	p := &Pool{
+		sem:        make(chan struct{}, workers),
+		queueSize:  queueSize,
+		maxPending: maxPending,
+		overflow:   cfg.Overflow,
+		queues:     make(map[string]*taskQueue),
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	// 提交方通常是连接的读取goroutine，它还负责接收API响应，
+	// 在其中等待空位会让等待API响应的处理任务无法完成，因此改由单独的goroutine等待
+	if p.overflow == OverflowBlock {
+		p.backlog = make(chan submission, maxPending)
+		p.fed = make(chan struct{})
+		go p.feed()
+	}
+	return p
+}
+
+// SessionKey 事件的会话标识 (self_id, user_id, group_id)
+func SessionKey(e *protocol.Event) string {
+	return fmt.Sprintf("%d:%d:%d", e.SelfID, e.UserID, e.GroupID)
+}
+
+// Submit 提交任务，同一key的任务按提交顺序执行，返回是否被接受（不会阻塞调用方，Stop后不再接受）
+func (p *Pool) Submit(key string, task func()) bool {
+	if p.backlog == nil {
+		return p.submit(key, task)
+	}
+
+	// 持锁投递，保证Stop关闭提交队列后不会再写入
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		utils.Debug("事件处理池已停止，丢弃新事件: key=%s", key)
+		return false
+	}
+
+	p.wg.Add(1)
+	select {
+	case p.backlog <- submission{key: key, task: task}:
+		return true
+	default:
+		p.wg.Done()
+		utils.Error("事件提交队列已满，丢弃新事件: key=%s", key)
+		return false
+	}
+}
+
+// feed 按顺序提交block策略下积压的任务，队列满时在此等待，提交队列关闭并取完后退出
+func (p *Pool) feed() {
+	defer close(p.fed)
+
+	for s := range p.backlog {
+		p.submit(s.key, s.task)
+		p.wg.Done()
+	}
+}
+
+// submit 将任务加入会话队列，按溢出策略处理队列已满的情况
+func (p *Pool) submit(key string, task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped && p.backlog == nil {
+		utils.Debug("事件处理池已停止，丢弃新事件: key=%s", key)
+		return false
+	}
+
+	q, running := p.queues[key]
+	if !running {
+		q = &taskQueue{}
+	}
+
+	for len(q.tasks) >= p.queueSize || p.pending >= p.maxPending {
+		switch p.overflow {
+		case OverflowBlock:
+			p.cond.Wait()
+			// 等待期间worker可能已退出，重新获取队列
+			if current, ok := p.queues[key]; ok {
+				q, running = current, true
+			} else if running {
+				q, running = &taskQueue{}, false
+			}
+			continue
+		case OverflowDropOldest:
+			if len(q.tasks) > 0 {
+				q.tasks = q.tasks[1:]
+				p.pending--
+				utils.Error("事件队列已满，丢弃最旧事件: key=%s", key)
+				continue
+			}
+		}
+
+		utils.Error("事件队列已满，丢弃新事件: key=%s, 会话排队=%d, 全局排队=%d", key, len(q.tasks), p.pending)
+		return false
+	}
+
+	q.tasks = append(q.tasks, task)
+	p.pending++
+
+	if !running {
+		p.queues[key] = q
+		p.wg.Add(1)
+		go p.run(key, q)
+	}
+	return true
+}
+
+// run 依次执行某个会话的任务，队列为空时退出
+func (p *Pool) run(key string, q *taskQueue) {
+	defer p.wg.Done()
+
+	for {
+		p.mu.Lock()
+		if len(q.tasks) == 0 {
+			delete(p.queues, key)
+			p.mu.Unlock()
+			return
+		}
+		task := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		p.pending--
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		// 每个任务单独占用并发名额，避免单个会话长期占满worker
+		p.sem <- struct{}{}
+		task()
+		<-p.sem
+	}
+}
+
+// Pending 当前排队中的任务数
+func (p *Pool) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pending
+}
+
+// Wait 等待所有已提交任务执行完成
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Stop 停止接收新任务，等待已提交任务执行完成，并结束block策略的提交goroutine
+func (p *Pool) Stop() {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		if p.backlog != nil {
+			close(p.backlog)
+		}
+	}
+	p.mu.Unlock()
+
+	if p.fed != nil {
+		<-p.fed
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,59 @@
+package event
+
+import (
+	"qq_bot/config"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolStop(t *testing.T) {
+	for _, overflow := range []string{OverflowDropNewest, OverflowDropOldest, OverflowBlock} {
+		t.Run(overflow, func(t *testing.T) {
+			p := NewPool(&config.DispatchConfig{Workers: 1, QueueSize: 1, MaxPending: 8, Overflow: overflow})
+
+			release := make(chan struct{})
+			var done atomic.Int32
+			p.Submit("a", func() {
+				<-release
+				done.Add(1)
+			})
+			p.Submit("b", func() { done.Add(1) })
+
+			stopped := make(chan struct{})
+			go func() {
+				p.Stop()
+				close(stopped)
+			}()
+
+			// 已提交的任务执行完成前Stop不返回
+			select {
+			case <-stopped:
+				t.Fatal("任务执行完成前Stop已返回")
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(release)
+
+			select {
+			case <-stopped:
+			case <-time.After(2 * time.Second):
+				t.Fatal("Stop未返回（提交goroutine未退出）")
+			}
+			if done.Load() != 2 {
+				t.Fatalf("执行了 %d 个任务, 期望 2 个", done.Load())
+			}
+			if p.fed != nil {
+				select {
+				case <-p.fed:
+				default:
+					t.Fatal("Stop后提交goroutine仍在运行")
+				}
+			}
+
+			if p.Submit("c", func() {}) {
+				t.Fatal("Stop后不应再接受任务")
+			}
+			p.Stop() // 重复Stop不应panic
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"sync"
+	"time"
+)
+
+// ErrWaitTimeout 等待回复超时
+var ErrWaitTimeout = errors.New("等待回复超时")
+
+// waiter 等待中的会话
+type waiter struct {
+	key     string
+	matcher Matcher
+	ch      chan *protocol.Event
+}
+
+// WaitFor 等待同一会话（同一账号、用户、群）中下一条满足条件的事件，matcher为nil时等待任意消息
+// 等到的事件不再进入正常分发；超时返回 ErrWaitTimeout，ctx取消时返回ctx的错误
+//
+//	reply, err := d.WaitFor(ctx, e, nil, 30*time.Second)
+func (d *Dispatcher) WaitFor(ctx context.Context, e *protocol.Event, matcher Matcher, timeout time.Duration) (*protocol.Event, error) {
+	if matcher == nil {
+		matcher = IsMessage()
+	}
+
+	w := &waiter{
+		key:     SessionKey(e),
+		matcher: matcher,
+		ch:      make(chan *protocol.Event, 1),
+	}
+
+	d.mu.Lock()
+	d.waiters = append(d.waiters, w)
+	d.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case next := <-w.ch:
+		return next, nil
+	case <-timer.C:
+		err = ErrWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// 超时和送达可能同时发生，仍在列表中说明尚未送达
+	if d.removeWaiter(w) {
+		return nil, err
+	}
+	return <-w.ch, nil
+}
+
+// Intercept 将事件交给等待中的会话，返回true表示事件已被消费
+// 必须在事件进入处理池之前调用，否则会被等待中的处理函数所在的会话队列阻塞；
+// 未被消费的事件记为排队中（之后的订阅可以认领），提交处理池失败时需调用 Untrack
+func (d *Dispatcher) Intercept(e *protocol.Event) bool {
+	if e == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := SessionKey(e)
+	for i, w := range d.waiters {
+		if w.key != key || !w.matcher(e) {
+			continue
+		}
+		d.waiters = append(d.waiters[:i:i], d.waiters[i+1:]...)
+		w.ch <- e
+		utils.Debug("事件交给等待中的会话: %s", key)
+		return true
+	}
+	for _, sub := range d.subs {
+		if sub.key != key || !sub.matcher(e) {
+			continue
+		}
+		sub.push(e)
+		utils.Debug("事件交给会话订阅: %s", key)
+		return true
+	}
+
+	d.queued[key] = append(d.queued[key], e)
+	return false
+}
+
+// Untrack 事件未能进入处理池时取消排队记录
+func (d *Dispatcher) Untrack(e *protocol.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := SessionKey(e)
+	queue := d.queued[key]
+	for i, item := range queue {
+		if item == e {
+			d.setQueued(key, append(queue[:i:i], queue[i+1:]...))
+			return
+		}
+	}
+}
+
+// dequeue 事件开始处理时移除排队记录，返回false表示已被订阅认领、不再处理
+// 同一会话按顺序处理，排在该事件之前的记录（被处理池丢弃的事件）一并移除
+func (d *Dispatcher) dequeue(e *protocol.Event) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.claimed[e] {
+		delete(d.claimed, e)
+		return false
+	}
+
+	key := SessionKey(e)
+	queue := d.queued[key]
+	for i, item := range queue {
+		if item == e {
+			d.setQueued(key, queue[i+1:])
+			break
+		}
+	}
+	return true
+}
+
+// setQueued 更新会话的排队记录，为空时删除（调用方持有锁）
+func (d *Dispatcher) setQueued(key string, queue []*protocol.Event) {
+	if len(queue) == 0 {
+		delete(d.queued, key)
+		return
+	}
+	d.queued[key] = queue
+}
+
+// removeWaiter 移除等待者，返回是否仍在列表中
+func (d *Dispatcher) removeWaiter(w *waiter) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, item := range d.waiters {
+		if item == w {
+			d.waiters = append(d.waiters[:i:i], d.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription 会话订阅：在Close之前持续拦截同一会话中满足条件的事件，
+// 与多次调用WaitFor不同，两次Next之间到达的事件也会被拦截，不会进入正常分发；
+// 订阅时已在处理池中排队的同一会话事件也会被认领
+type Subscription struct {
+	d       *Dispatcher
+	key     string
+	matcher Matcher
+	mu      sync.Mutex
+	queue   []*protocol.Event
+	signal  chan struct{}
+}
+
+// Subscribe 订阅同一会话中满足条件的事件，matcher为nil时订阅任意消息，用完后必须调用Close
+//
+//	sub := d.Subscribe(e, nil)
+//	next, err := sub.Next(ctx, 3*time.Second)
+//	rest := sub.Close()
+func (d *Dispatcher) Subscribe(e *protocol.Event, matcher Matcher) *Subscription {
+	if matcher == nil {
+		matcher = IsMessage()
+	}
+
+	sub := &Subscription{
+		d:       d,
+		key:     SessionKey(e),
+		matcher: matcher,
+		signal:  make(chan struct{}, 1),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 认领已排队但尚未处理的事件，轮到它们时不再分发
+	var rest []*protocol.Event
+	for _, queued := range d.queued[sub.key] {
+		if matcher(queued) {
+			sub.queue = append(sub.queue, queued)
+			d.claimed[queued] = true
+		} else {
+			rest = append(rest, queued)
+		}
+	}
+	d.setQueued(sub.key, rest)
+
+	d.subs = append(d.subs, sub)
+	return sub
+}
+
+// Next 取出下一个拦截到的事件，超时返回 ErrWaitTimeout，ctx取消时返回ctx的错误
+func (s *Subscription) Next(ctx context.Context, timeout time.Duration) (*protocol.Event, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		if e := s.pop(); e != nil {
+			return e, nil
+		}
+
+		select {
+		case <-s.signal:
+		case <-timer.C:
+			return nil, ErrWaitTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close 取消订阅，返回已拦截但尚未取出的事件（调用方负责处理，否则这些事件会丢失）
+func (s *Subscription) Close() []*protocol.Event {
+	s.d.mu.Lock()
+	for i, item := range s.d.subs {
+		if item == s {
+			s.d.subs = append(s.d.subs[:i:i], s.d.subs[i+1:]...)
+			break
+		}
+	}
+	s.d.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rest := s.queue
+	s.queue = nil
+	return rest
+}
+
+// push 加入拦截到的事件（在连接读取goroutine中调用，不能阻塞）
+func (s *Subscription) push(e *protocol.Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop 取出最早拦截到的事件
+func (s *Subscription) pop() *protocol.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return nil
+	}
+	e := s.queue[0]
+	s.queue = s.queue[1:]
+	return e
+}
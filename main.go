@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"qq_bot/bot"
+	"qq_bot/command"
 	"qq_bot/config"
 	"qq_bot/connection"
 	"qq_bot/event"
+	"qq_bot/plugin"
+	_ "qq_bot/plugins/dice" // 示例插件
 	"qq_bot/protocol"
 	"qq_bot/service/ai"
+	"qq_bot/service/history"
 	"qq_bot/service/message"
+	"qq_bot/service/outbox"
+	"qq_bot/service/participation"
+	"qq_bot/service/permission"
 	"qq_bot/service/relationship"
 	"qq_bot/storage"
 	"qq_bot/utils"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -26,38 +37,38 @@ func main() {
 		utils.Error("数据库初始化失败: %v", err)
 		os.Exit(1)
 	}
+	if err := storage.BackfillSelfID(accountIDs(cfg)); err != nil {
+		utils.Error("旧数据迁移失败: %v", err)
+		os.Exit(1)
+	}
 
 	// 创建AI服务
 	openaiService := ai.NewOpenAIService(cfg.AI)
 	utils.Info("AI服务初始化完成: Model=%s", cfg.AI.Model)
 
-	// 创建关系评估服务
-	relationshipService := relationship.NewService(openaiService.GetClient(), storage.GetDB())
-	utils.Info("关系评估服务初始化完成")
-
-	// 创建事件分发器
-	dispatcher := event.NewDispatcher()
-
-	// 注册中间件
-	dispatcher.Use(event.RecoverMiddleware)
-	dispatcher.Use(event.LoggerMiddleware)
-
-	// 创建WebSocket客户端
-	wsClient := connection.NewWSClient(cfg.NapCat, dispatcher.Dispatch)
-
-	// 创建协议API
-	api := protocol.NewAPI(wsClient.SendMessage)
+	// 创建多账号管理器
+	manager := bot.NewManager(cfg.Dispatch)
 
-	// 创建消息服务
-	msgService := message.NewMessageService(api, openaiService, relationshipService, cfg.AllowedQQs)
+	if cfg.Recorder != nil && cfg.Recorder.Enabled {
+		recorder, err := connection.NewRecorder(cfg.Recorder.Path)
+		if err != nil {
+			utils.Error("创建录制器失败: %v", err)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+		manager.SetRecorder(recorder)
+		utils.Info("流量录制已开启: %s", cfg.Recorder.Path)
+	}
 
-	// 注册事件处理器
-	dispatcher.OnMessage(msgService.HandleMessage)
-	dispatcher.OnMeta(handleMetaEvent)
+	services, err := setupAccounts(manager, cfg, openaiService)
+	if err != nil {
+		utils.Error("%v", err)
+		os.Exit(1)
+	}
 
-	// 启动WebSocket连接
-	if err := wsClient.Start(); err != nil {
-		utils.Error("启动WebSocket失败: %v", err)
+	// 启动所有连接
+	if err := manager.Start(); err != nil {
+		utils.Error("启动连接失败: %v", err)
 		os.Exit(1)
 	}
 
@@ -69,10 +80,105 @@ func main() {
 	<-quit
 
 	utils.Info("正在关闭机器人...")
-	wsClient.Stop()
+	shutdown(manager, services)
 	utils.Info("机器人已关闭")
 }
 
+// accountServices 单个账号的后台服务（关闭时使用）
+type accountServices struct {
+	outbox  *outbox.Service
+	plugins *plugin.Manager
+}
+
+// setupAccounts 为每个账号创建机器人实例，注册服务、命令和插件
+func setupAccounts(manager *bot.Manager, cfg *config.Config, openaiService *ai.OpenAIService) ([]*accountServices, error) {
+	services := make([]*accountServices, 0)
+
+	for _, account := range cfg.GetAccounts() {
+		b, err := manager.Add(account)
+		if err != nil {
+			return nil, fmt.Errorf("创建账号失败: %v", err)
+		}
+
+		// 创建关系评估服务
+		relationshipService := relationship.NewService(openaiService.GetClient(), storage.GetDB(), b.SelfID, account.PromptDir)
+
+		// 注册中间件
+		b.Dispatcher.Use(event.RecoverMiddleware)
+		b.Dispatcher.Use(event.LoggerMiddleware)
+
+		// 创建发件箱（连接恢复后继续发送）
+		outboxService := outbox.NewService(b.SelfID, b.API, cfg.Outbox)
+		b.OnStateChange(outboxService.HandleStateChange)
+		if err := outboxService.Start(); err != nil {
+			return nil, fmt.Errorf("发件箱启动失败: %v", err)
+		}
+
+		// 创建权限服务
+		permissionService, err := permission.NewService(b.SelfID, account.Owners, account.AllowedQQs, cfg.Permission)
+		if err != nil {
+			return nil, fmt.Errorf("权限服务初始化失败: %v", err)
+		}
+
+		// 创建消息服务
+		msgService := message.NewMessageService(b.SelfID, b.API, outboxService, openaiService, relationshipService, cfg.History, cfg.Burst, permissionService)
+
+		// 注册事件处理器
+		msgService.Register(b.Dispatcher)
+		participation.NewPolicy(account.GroupChat, outboxService).Register(b.Dispatcher)
+		event.On(b.Dispatcher, handleHeartbeat)
+		event.On(b.Dispatcher, handleLifecycle)
+
+		// 定期彻底删除超过撤销时间和保留天数的历史记录
+		go history.NewHistoryService(b.SelfID).RunPurge(manager.Context(), cfg.History.GetUndoWindow(), cfg.History.GetRetentionDays())
+
+		// 注册命令
+		commands := command.NewRegistry(msgService.Reply, account.Owners)
+		commands.SetPermission(permissionService.CommandLevel)
+		msgService.RegisterCommands(commands)
+		permissionService.RegisterCommands(commands)
+		commands.Attach(b.Dispatcher)
+
+		// 加载插件
+		pluginManager, err := plugin.NewManager(b.SelfID, b.API, outboxService, cfg, account, b.Dispatcher, commands)
+		if err != nil {
+			return nil, fmt.Errorf("插件管理器初始化失败: %v", err)
+		}
+		pluginManager.SetPermission(permissionService.ScopeLevel)
+		pluginManager.LoadRegistered(manager.Context())
+
+		services = append(services, &accountServices{outbox: outboxService, plugins: pluginManager})
+		utils.Info("账号初始化完成: self_id=%d, 人设目录=%s", b.SelfID, account.PromptDir)
+	}
+
+	return services, nil
+}
+
+// shutdown 停止连接和事件处理，再关闭插件和发件箱
+func shutdown(manager *bot.Manager, services []*accountServices) {
+	manager.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, s := range services {
+		s.plugins.Shutdown(ctx)
+	}
+	for _, s := range services {
+		s.outbox.Stop()
+	}
+}
+
+// accountIDs 获取所有配置账号的QQ号
+func accountIDs(cfg *config.Config) []int64 {
+	accounts := cfg.GetAccounts()
+	ids := make([]int64, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.SelfID)
+	}
+	return ids
+}
+
 // loadConfig 加载配置
 func loadConfig() *config.Config {
 	configFile := "config.json"
@@ -96,16 +202,37 @@ func loadConfig() *config.Config {
 
 	cfg := config.Get()
 	utils.Info("配置加载成功")
-	utils.Info("NapCat服务器: ws://%s:%d", cfg.NapCat.Host, cfg.NapCat.Port)
+	for _, account := range cfg.GetAccounts() {
+		logAccount(account)
+	}
 
 	return cfg
 }
 
-// handleMetaEvent 处理元事件
-func handleMetaEvent(e *protocol.Event) {
-	if e.MetaEventType == "heartbeat" {
-		utils.Debug("收到心跳: interval=%d", e.Interval)
-	} else if e.MetaEventType == "lifecycle" {
-		utils.Info("生命周期事件: %s", e.SubType)
+// logAccount 输出账号连接信息
+func logAccount(account *config.AccountConfig) {
+	napcat := account.NapCat
+	if napcat == nil {
+		return
 	}
+
+	switch napcat.Mode {
+	case connection.ModeReverse:
+		utils.Info("[%d] NapCat反向连接监听: %s:%d%s", account.SelfID, napcat.ListenHost, napcat.ListenPort, napcat.ListenPath)
+	case connection.ModeHTTP:
+		utils.Info("[%d] NapCat HTTP API: http://%s:%d, 事件监听: %s:%d%s",
+			account.SelfID, napcat.Host, napcat.Port, napcat.ListenHost, napcat.ListenPort, napcat.ListenPath)
+	default:
+		utils.Info("[%d] NapCat服务器: ws://%s:%d", account.SelfID, napcat.Host, napcat.Port)
+	}
+}
+
+// handleHeartbeat 处理心跳元事件
+func handleHeartbeat(ctx context.Context, e protocol.HeartbeatMetaEvent) {
+	utils.Log(ctx).Debug("收到心跳: interval=%d, online=%v", e.Interval, e.Online())
+}
+
+// handleLifecycle 处理生命周期元事件
+func handleLifecycle(ctx context.Context, e protocol.LifecycleMetaEvent) {
+	utils.Log(ctx).Info("生命周期事件: %s", e.SubType)
 }
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"qq_bot/bot"
+	"qq_bot/config"
+	"qq_bot/connection"
+	"qq_bot/connection/fakeonebot"
+	"qq_bot/protocol"
+	"qq_bot/service/ai"
+	"qq_bot/storage"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/sashabaranov/go-openai"
+)
+
+// stubAI 假AI服务：对话请求返回固定回复，关系评估请求返回固定评估结果
+type stubAI struct {
+	*httptest.Server
+	reply      string
+	evaluation string
+	mu         sync.Mutex
+	chats      []openai.ChatCompletionRequest
+}
+
+// newStubAI 创建假AI服务
+func newStubAI(t *testing.T, reply string) *stubAI {
+	s := &stubAI{
+		reply:      reply,
+		evaluation: `{"familiarity_change":3,"trust_change":1,"intimacy_change":0,"is_key_moment":false,"reason":"回放测试"}`,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// handle 应答 /v1/chat/completions（对话请求以system消息开头，评估请求只有一条user消息）
+func (s *stubAI) handle(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	content := s.evaluation
+	if len(req.Messages) > 0 && req.Messages[0].Role == openai.ChatMessageRoleSystem {
+		s.mu.Lock()
+		s.chats = append(s.chats, req)
+		s.mu.Unlock()
+		content = s.reply
+	}
+
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+		}},
+	})
+}
+
+// Chats 获取收到的对话请求
+func (s *stubAI) Chats() []openai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionRequest(nil), s.chats...)
+}
+
+// testBot 测试环境：临时SQLite数据库 + 假AI，服务装配与main相同
+type testBot struct {
+	manager  *bot.Manager
+	replayer *connection.Replayer
+	services []*accountServices
+}
+
+// testConfig 回放测试使用的配置（单账号10001，用户123456在白名单中）
+func testConfig(aiURL string) *config.Config {
+	cfg := config.GetDefault()
+	cfg.AI.BaseURL = aiURL
+	cfg.NapCat.SelfID = 10001
+	cfg.AllowedQQs = []int64{123456}
+	cfg.Burst = &config.BurstConfig{Windows: []int{0}} // 关闭连续消息聚合
+	cfg.Outbox.TargetInterval = 0
+	cfg.Outbox.GlobalInterval = 0
+	return cfg
+}
+
+// startBot 使用测试数据库装配服务并启动连接（factory为nil时使用配置的真实连接）
+func startBot(t *testing.T, cfg *config.Config, factory bot.ConnectionFactory) *testBot {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	if err := storage.Open(sqlite.Open(dsn)); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+
+	b := &testBot{manager: bot.NewManager(cfg.Dispatch)}
+	if factory != nil {
+		b.manager.SetConnectionFactory(factory)
+	}
+
+	var err error
+	b.services, err = setupAccounts(b.manager, cfg, ai.NewOpenAIService(cfg.AI))
+	if err != nil {
+		t.Fatalf("装配服务失败: %v", err)
+	}
+	t.Cleanup(func() { shutdown(b.manager, b.services) })
+
+	if err := b.manager.Start(); err != nil {
+		t.Fatalf("启动连接失败: %v", err)
+	}
+	return b
+}
+
+// startReplay 用回放连接代替NapCat启动测试环境，回放录制文件
+func startReplay(t *testing.T, cfg *config.Config, recording string) *testBot {
+	t.Helper()
+
+	frames, err := connection.LoadRecording(recording)
+	if err != nil {
+		t.Fatalf("加载录制文件失败: %v", err)
+	}
+
+	var replayer *connection.Replayer
+	b := startBot(t, cfg, func(account *config.AccountConfig, handler func(*protocol.Event)) (connection.Connection, error) {
+		replayer = connection.NewReplayer(account.NapCat, frames, 0, handler)
+		return replayer, nil
+	})
+	b.replayer = replayer
+	return b
+}
+
+// wait 等待回放、事件处理和发件箱发送完成，返回发出的请求
+func (b *testBot) wait(t *testing.T) []protocol.SendMessageReq {
+	t.Helper()
+
+	select {
+	case <-b.replayer.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("回放超时")
+	}
+	b.manager.Wait()
+
+	for _, s := range b.services {
+		waitUntil(t, "发件箱发送完成", s.outbox.Idle)
+	}
+	return b.replayer.Sent()
+}
+
+// waitUntil 轮询等待条件成立（关系评估等后台任务）
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// sentTexts 获取发往某个用户的私聊消息文本
+func sentTexts(sent []protocol.SendMessageReq, userID int64) []string {
+	var texts []string
+	for _, req := range sent {
+		if req.Action != "send_private_msg" {
+			continue
+		}
+		var params struct {
+			UserID  int64           `json:"user_id"`
+			Message json.RawMessage `json:"message"`
+		}
+		data, _ := json.Marshal(req.Params)
+		if json.Unmarshal(data, &params) != nil || params.UserID != userID {
+			continue
+		}
+		texts = append(texts, protocol.ParseMessage(params.Message).PlainText())
+	}
+	return texts
+}
+
+func TestReplayPrivateChat(t *testing.T) {
+	stub := newStubAI(t, "你好呀，今天过得怎么样？")
+	h := startReplay(t, testConfig(stub.URL), "testdata/replay/private_chat.jsonl")
+	sent := h.wait(t)
+
+	texts := sentTexts(sent, 123456)
+	if len(texts) != 1 || texts[0] != "你好呀，今天过得怎么样？" {
+		t.Fatalf("私聊回复 = %q, 期望一条AI回复", texts)
+	}
+
+	chats := stub.Chats()
+	if len(chats) != 1 {
+		t.Fatalf("AI对话请求 %d 次, 期望 1 次", len(chats))
+	}
+	messages := chats[0].Messages
+	if last := messages[len(messages)-1]; last.Role != openai.ChatMessageRoleUser || last.Content != "你好" {
+		t.Fatalf("AI请求最后一条消息 = %+v, 期望用户消息\"你好\"", last)
+	}
+
+	var histories []storage.ChatHistory
+	storage.GetDB().Where("self_id = ? AND qq_id = ?", 10001, 123456).Order("id").Find(&histories)
+	if len(histories) != 2 || histories[0].Role != "user" || histories[1].Role != "assistant" {
+		t.Fatalf("对话历史 = %+v, 期望用户消息和AI回复各一条", histories)
+	}
+
+	// 关系评估在后台执行，使用假AI返回的评估结果
+	var rel storage.UserRelationship
+	waitUntil(t, "关系评估完成", func() bool {
+		err := storage.GetDB().Where("self_id = ? AND qq_id = ?", 10001, 123456).First(&rel).Error
+		return err == nil && rel.TotalMessages == 1 && rel.Familiarity > 0
+	})
+	if rel.Familiarity != 3 || rel.Trust != 1 {
+		t.Fatalf("关系分数 熟悉%.1f 信任%.1f, 期望 熟悉3 信任1", rel.Familiarity, rel.Trust)
+	}
+}
+
+func TestReplayPrivateBurst(t *testing.T) {
+	stub := newStubAI(t, "辛苦啦")
+	cfg := testConfig(stub.URL)
+	cfg.Burst = &config.BurstConfig{Windows: []int{300}, MaxWait: 3000}
+	sent := startReplay(t, cfg, "testdata/replay/private_burst.jsonl").wait(t)
+
+	// 连续的三条消息只回复一次
+	if texts := sentTexts(sent, 123456); len(texts) != 1 {
+		t.Fatalf("私聊回复 = %q, 期望一条", texts)
+	}
+	if chats := stub.Chats(); len(chats) != 1 {
+		t.Fatalf("AI对话请求 %d 次, 期望 1 次", len(chats))
+	}
+
+	// 每条消息都保存到历史
+	var contents []string
+	storage.GetDB().Model(&storage.ChatHistory{}).
+		Where("self_id = ? AND qq_id = ? AND role = ?", 10001, 123456, "user").
+		Order("id").Pluck("content", &contents)
+	if strings.Join(contents, "|") != "在吗|今天好累|加班到现在" {
+		t.Fatalf("用户消息历史 = %q", contents)
+	}
+}
+
+func TestReplayGroupMentionWithoutGroupContext(t *testing.T) {
+	stub := newStubAI(t, "晚上好呀")
+	cfg := testConfig(stub.URL)
+	cfg.History = &config.HistoryConfig{UndoWindow: 1440} // 旧配置文件没有group_context
+	sent := startReplay(t, cfg, "testdata/replay/group_mention.jsonl").wait(t)
+
+	groupReplies := 0
+	for _, req := range sent {
+		if req.Action == "send_group_msg" {
+			groupReplies++
+		}
+	}
+	if groupReplies != 1 {
+		t.Fatalf("群回复 %d 条, 期望 1 条", groupReplies)
+	}
+
+	// 群聊中当前消息只通过群聊记录进入提示词
+	chats := stub.Chats()
+	if len(chats) != 1 {
+		t.Fatalf("AI对话请求 %d 次, 期望 1 次", len(chats))
+	}
+	messages := chats[0].Messages
+	if last := messages[len(messages)-1]; last.Role != openai.ChatMessageRoleUser || !strings.Contains(last.Content, "小明: 晚上好") {
+		t.Fatalf("AI请求最后一条消息 = %q, 期望包含群聊记录\"小明: 晚上好\"", last.Content)
+	}
+}
+
+func TestFakeOneBotPrivateChat(t *testing.T) {
+	srv := fakeonebot.New(10001, "token")
+	if err := srv.Start(); err != nil {
+		t.Fatalf("启动假OneBot服务端失败: %v", err)
+	}
+	defer srv.Close()
+
+	stub := newStubAI(t, "在的")
+	cfg := testConfig(stub.URL)
+	cfg.NapCat = srv.Config()
+	startBot(t, cfg, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := srv.InjectPrivateMessage(123456, "小明", "在吗"); err != nil {
+		t.Fatalf("推送私聊消息失败: %v", err)
+	}
+	action, err := srv.WaitAction(ctx, "send_private_msg", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	texts := sentTexts([]protocol.SendMessageReq{{Action: action.Action, Params: action.Params}}, 123456)
+	if len(texts) != 1 || texts[0] != "在的" {
+		t.Fatalf("send_private_msg 参数 = %v, 期望回复用户123456\"在的\"", action.Params)
+	}
+}
+
+func TestReplayGroupTranscriptRecordsEveryone(t *testing.T) {
+	stub := newStubAI(t, "是挺热的")
+	sent := startReplay(t, testConfig(stub.URL), "testdata/replay/group_transcript.jsonl").wait(t)
+
+	// 只回复@机器人的白名单用户
+	groupReplies := 0
+	for _, req := range sent {
+		if req.Action == "send_group_msg" {
+			groupReplies++
+		}
+	}
+	if groupReplies != 1 {
+		t.Fatalf("群回复 %d 条, 期望 1 条", groupReplies)
+	}
+
+	// 不在白名单的群成员发言也进入群聊记录，命令不记录
+	var records []storage.ChatHistory
+	storage.GetDB().Where("self_id = ? AND group_id = ? AND role = ?", 10001, 888, "user").Order("qq_id").Find(&records)
+	if len(records) != 2 || records[0].QQId != 123456 || records[1].QQId != 654321 || records[1].Content != "今天好热" {
+		t.Fatalf("群聊记录 = %+v, 期望小明和路人各一条", records)
+	}
+}
@@ -0,0 +1,300 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/command"
+	"qq_bot/config"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"qq_bot/service/outbox"
+	"qq_bot/storage"
+	"qq_bot/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// entry 已加载的插件
+type entry struct {
+	plugin Plugin
+	meta   Meta
+	loaded atomic.Bool // Init成功后为true，失败的插件规则不匹配
+}
+
+// ScopeLevelFunc 获取调用者在指定范围（群号，0为全局）内的权限等级
+type ScopeLevelFunc func(e *protocol.Event, groupID int64) command.Level
+
+// Manager 单个账号的插件管理器
+type Manager struct {
+	selfID     int64
+	api        *protocol.API
+	outbox     *outbox.Service
+	cfg        *config.Config
+	account    *config.AccountConfig
+	dispatcher *event.Dispatcher
+	commands   *command.Registry
+	states     *stateStore
+	scopeLevel ScopeLevelFunc
+
+	mu      sync.RWMutex
+	entries []*entry
+	byName  map[string]*entry
+}
+
+// NewManager 创建插件管理器，并注册插件管理命令 /plugin
+func NewManager(selfID int64, api *protocol.API, outboxService *outbox.Service, cfg *config.Config, account *config.AccountConfig, dispatcher *event.Dispatcher, commands *command.Registry) (*Manager, error) {
+	states, err := newStateStore(storage.GetDB(), selfID)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		selfID:     selfID,
+		api:        api,
+		outbox:     outboxService,
+		cfg:        cfg,
+		account:    account,
+		dispatcher: dispatcher,
+		commands:   commands,
+		states:     states,
+		entries:    make([]*entry, 0),
+		byName:     make(map[string]*entry),
+	}
+
+	commands.MustRegister(&command.Command{
+		Name:        "plugin",
+		Description: "插件管理",
+		Args: []command.Arg{
+			{Name: "操作", Choices: []string{"list", "enable", "disable"}},
+			{Name: "插件名", Optional: true},
+			{Name: "范围", Optional: true, Choices: []string{ScopeGroup, ScopeUser}},
+			{Name: "ID", Type: command.ArgInt, Optional: true, Desc: "群号或QQ号"},
+		},
+		Usage:   "不指定范围时作用于当前群（私聊时为当前用户）；指定其他群需要该群的管理员，指定用户需要全局管理员",
+		Level:   command.LevelAdmin,
+		Handler: m.handleAdmin,
+	})
+	return m, nil
+}
+
+// SetPermission 设置范围权限等级获取函数（通常为 permission.Service.ScopeLevel），
+// 未设置时只有主人能管理当前会话以外的范围
+func (m *Manager) SetPermission(scopeLevel ScopeLevelFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scopeLevel = scopeLevel
+}
+
+// LoadRegistered 加载所有通过 Register 注册的插件
+func (m *Manager) LoadRegistered(ctx context.Context) {
+	for _, factory := range Registered() {
+		m.Load(ctx, factory())
+	}
+}
+
+// Load 加载插件，初始化失败的插件不会处理任何事件
+func (m *Manager) Load(ctx context.Context, plugins ...Plugin) {
+	for _, p := range plugins {
+		meta := p.Meta()
+
+		m.mu.Lock()
+		if _, exists := m.byName[meta.Name]; exists || meta.Name == "" {
+			m.mu.Unlock()
+			utils.Error("插件名称无效或重复: %q", meta.Name)
+			continue
+		}
+		e := &entry{plugin: p, meta: meta}
+		m.entries = append(m.entries, e)
+		m.byName[meta.Name] = e
+		m.mu.Unlock()
+
+		pc := &Context{
+			SelfID:  m.selfID,
+			API:     m.api,
+			DB:      storage.GetDB(),
+			Outbox:  m.outbox,
+			Config:  m.cfg,
+			Account: m.account,
+			name:    meta.Name,
+			manager: m,
+		}
+		if err := p.Init(ctx, pc); err != nil {
+			utils.Error("插件 %s 初始化失败: %v", meta.Name, err)
+			continue
+		}
+		e.loaded.Store(true)
+		utils.Info("账号 %d 已加载插件: %s %s", m.selfID, meta.Name, meta.Version)
+	}
+}
+
+// Shutdown 按加载的逆序关闭插件
+func (m *Manager) Shutdown(ctx context.Context) {
+	m.mu.RLock()
+	entries := append([]*entry(nil), m.entries...)
+	m.mu.RUnlock()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !e.loaded.Swap(false) {
+			continue
+		}
+		if err := e.plugin.Shutdown(ctx); err != nil {
+			utils.Error("插件 %s 关闭失败: %v", e.meta.Name, err)
+		}
+	}
+}
+
+// enabledMatcher 插件已加载且在事件所在群/用户启用时匹配
+func (m *Manager) enabledMatcher(name string) event.Matcher {
+	return func(e *protocol.Event) bool {
+		m.mu.RLock()
+		ent := m.byName[name]
+		m.mu.RUnlock()
+		if ent == nil || !ent.loaded.Load() {
+			return false
+		}
+		return m.states.enabled(name, e, !ent.meta.DisabledByDefault)
+	}
+}
+
+// handleAdmin 处理插件管理命令
+//
+//	/plugin list
+//	/plugin enable|disable <插件名> [group|user <ID>]
+func (m *Manager) handleAdmin(ctx context.Context, call *command.Call) error {
+	e := call.Event
+	if call.Args.String("操作") == "list" {
+		call.Reply(ctx, m.listText(e))
+		return nil
+	}
+
+	name := call.Args.String("插件名")
+	if name == "" {
+		call.Reply(ctx, "请指定插件名")
+		return nil
+	}
+	m.mu.RLock()
+	_, exists := m.byName[name]
+	m.mu.RUnlock()
+	if !exists {
+		call.Reply(ctx, "未知插件: "+name)
+		return nil
+	}
+
+	scopeType, scopeID, err := parseScope(e, call.Args)
+	if err != nil {
+		call.Reply(ctx, err.Error())
+		return nil
+	}
+	if !m.canManage(call, scopeType, scopeID) {
+		if scopeType == ScopeGroup {
+			call.Reply(ctx, fmt.Sprintf("权限不足，需要群 %d 的管理员权限", scopeID))
+		} else {
+			call.Reply(ctx, "权限不足，管理用户范围需要全局管理员权限")
+		}
+		return nil
+	}
+
+	enabled := call.Args.String("操作") == "enable"
+	if err := m.states.set(name, scopeType, scopeID, enabled); err != nil {
+		return err
+	}
+	utils.Log(ctx).Info("插件 %s 在 %s %d %s", name, scopeType, scopeID, stateName(enabled))
+	call.Reply(ctx, fmt.Sprintf("插件 %s 已在%s %d %s", name, scopeName(scopeType), scopeID, stateName(enabled)))
+	return nil
+}
+
+// canManage 检查调用者能否管理该范围：群范围需要该群的管理员，用户范围需要全局管理员
+// （与 /grant 一致，当前会话的权限已由命令等级检查）
+func (m *Manager) canManage(call *command.Call, scopeType string, scopeID int64) bool {
+	e := call.Event
+	groupID := int64(0)
+	if scopeType == ScopeGroup {
+		groupID = scopeID
+	}
+	if groupID == e.GroupID {
+		return true
+	}
+
+	m.mu.RLock()
+	scopeLevel := m.scopeLevel
+	m.mu.RUnlock()
+	if scopeLevel == nil {
+		return call.Level >= command.LevelOwner
+	}
+	return scopeLevel(e, groupID) >= command.LevelAdmin
+}
+
+// listText 生成插件列表（显示在当前会话中的状态）
+func (m *Manager) listText(e *protocol.Event) string {
+	m.mu.RLock()
+	entries := append([]*entry(nil), m.entries...)
+	m.mu.RUnlock()
+
+	if len(entries) == 0 {
+		return "暂无插件"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("插件列表:")
+	for _, ent := range entries {
+		status := stateName(m.states.enabled(ent.meta.Name, e, !ent.meta.DisabledByDefault))
+		if !ent.loaded.Load() {
+			status = "加载失败"
+		}
+		sb.WriteString(fmt.Sprintf("\n%s %s [%s] - %s", ent.meta.Name, ent.meta.Version, status, ent.meta.Description))
+	}
+	return sb.String()
+}
+
+// parseScope 解析作用范围参数，未指定时使用当前会话
+func parseScope(e *protocol.Event, args command.Args) (string, int64, error) {
+	if !args.Has("范围") {
+		if e.MessageType == "group" {
+			return ScopeGroup, e.GroupID, nil
+		}
+		return ScopeUser, e.UserID, nil
+	}
+
+	id := args.Int("ID")
+	if id <= 0 {
+		return "", 0, fmt.Errorf("请指定有效的群号或QQ号")
+	}
+	return args.String("范围"), id, nil
+}
+
+// reply 回复事件来源
+func (m *Manager) reply(e *protocol.Event, text string) error {
+	var targetID int64
+	switch e.MessageType {
+	case "private":
+		targetID = e.UserID
+	case "group":
+		targetID = e.GroupID
+	default:
+		return fmt.Errorf("不支持回复的消息类型: %s", e.MessageType)
+	}
+
+	if _, err := m.outbox.Enqueue(e.MessageType, targetID, protocol.BuildArrayMessage(text)); err != nil {
+		utils.Error("发送消息失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// stateName 启用状态名称
+func stateName(enabled bool) string {
+	if enabled {
+		return "启用"
+	}
+	return "禁用"
+}
+
+// scopeName 范围名称
+func scopeName(scopeType string) string {
+	if scopeType == ScopeGroup {
+		return "群"
+	}
+	return "用户"
+}
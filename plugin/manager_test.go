@@ -0,0 +1,202 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"qq_bot/command"
+	"qq_bot/config"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"qq_bot/service/outbox"
+	"qq_bot/storage"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+)
+
+// testPlugin 记录初始化、关闭和规则触发次数的插件
+type testPlugin struct {
+	mu       sync.Mutex
+	inits    int
+	shutdown int
+	pings    int
+}
+
+func (p *testPlugin) Meta() Meta {
+	return Meta{Name: "pinger", Description: "测试插件", Version: "1.0"}
+}
+
+func (p *testPlugin) Init(ctx context.Context, pc *Context) error {
+	p.mu.Lock()
+	p.inits++
+	p.mu.Unlock()
+
+	pc.Handle(event.Keyword("ping"), func(ctx context.Context, e *protocol.Event) bool {
+		p.mu.Lock()
+		p.pings++
+		p.mu.Unlock()
+		return true
+	})
+	return nil
+}
+
+func (p *testPlugin) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.shutdown++
+	p.mu.Unlock()
+	return nil
+}
+
+// counts 获取计数
+func (p *testPlugin) counts() (inits, pings, shutdown int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inits, p.pings, p.shutdown
+}
+
+// testManager 插件管理器测试环境：临时SQLite数据库，命令回复记录在replies中
+type testManager struct {
+	manager    *Manager
+	dispatcher *event.Dispatcher
+	mu         sync.Mutex
+	replies    []string
+}
+
+// newTestManager 创建插件管理器：用户1为主人，用户2只是群888的管理员
+func newTestManager(t *testing.T) *testManager {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	if err := storage.Open(sqlite.Open(dsn)); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	outboxService := outbox.NewService(10001, nil, nil)
+	t.Cleanup(outboxService.Stop)
+
+	tm := &testManager{dispatcher: event.NewDispatcher()}
+	scopeLevel := func(e *protocol.Event, groupID int64) command.Level {
+		switch {
+		case e.UserID == 1:
+			return command.LevelOwner
+		case e.UserID == 2 && groupID == 888:
+			return command.LevelAdmin
+		}
+		return command.LevelUser
+	}
+
+	commands := command.NewRegistry(func(ctx context.Context, e *protocol.Event, text string) {
+		tm.mu.Lock()
+		tm.replies = append(tm.replies, text)
+		tm.mu.Unlock()
+	}, []int64{1})
+	commands.SetPermission(func(ctx context.Context, e *protocol.Event) command.Level {
+		return scopeLevel(e, e.GroupID)
+	})
+	commands.Attach(tm.dispatcher)
+
+	m, err := NewManager(10001, nil, outboxService, config.GetDefault(), &config.AccountConfig{SelfID: 10001}, tm.dispatcher, commands)
+	if err != nil {
+		t.Fatalf("创建插件管理器失败: %v", err)
+	}
+	m.SetPermission(scopeLevel)
+	tm.manager = m
+	return tm
+}
+
+// send 分发一条群消息，返回命令回复
+func (tm *testManager) send(groupID, userID int64, text string) string {
+	tm.mu.Lock()
+	tm.replies = nil
+	tm.mu.Unlock()
+
+	message, _ := json.Marshal(protocol.BuildArrayMessage(text))
+	tm.dispatcher.Dispatch(context.Background(), &protocol.Event{
+		SelfID:      10001,
+		PostType:    "message",
+		MessageType: "group",
+		GroupID:     groupID,
+		UserID:      userID,
+		Message:     message,
+	})
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return strings.Join(tm.replies, "\n")
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	tm := newTestManager(t)
+	p := &testPlugin{}
+	Register(func() Plugin { return p })
+	tm.manager.LoadRegistered(context.Background())
+
+	if inits, _, _ := p.counts(); inits != 1 {
+		t.Fatalf("Init 调用 %d 次, 期望 1 次", inits)
+	}
+	tm.send(888, 3, "ping")
+	if _, pings, _ := p.counts(); pings != 1 {
+		t.Fatalf("启用时规则触发 %d 次, 期望 1 次", pings)
+	}
+
+	// 群管理员在本群禁用后规则不再匹配，其他群不受影响
+	if reply := tm.send(888, 2, "/plugin disable pinger"); !strings.Contains(reply, "已在群 888 禁用") {
+		t.Fatalf("禁用回复 = %q", reply)
+	}
+	tm.send(888, 3, "ping")
+	if _, pings, _ := p.counts(); pings != 1 {
+		t.Fatalf("禁用后规则仍被触发, 共 %d 次", pings)
+	}
+	tm.send(999, 3, "ping")
+	if _, pings, _ := p.counts(); pings != 2 {
+		t.Fatalf("其他群规则触发 %d 次, 期望累计 2 次", pings)
+	}
+
+	// 设置已持久化
+	var state storage.PluginState
+	if err := storage.GetDB().Where("self_id = ? AND plugin_name = ? AND scope_type = ? AND scope_id = ?",
+		10001, "pinger", ScopeGroup, 888).First(&state).Error; err != nil || state.Enabled {
+		t.Fatalf("插件状态 = %+v, %v, 期望群888禁用", state, err)
+	}
+
+	// Shutdown后规则不再匹配
+	tm.manager.Shutdown(context.Background())
+	if _, _, shutdown := p.counts(); shutdown != 1 {
+		t.Fatalf("Shutdown 调用 %d 次, 期望 1 次", shutdown)
+	}
+	tm.send(999, 3, "ping")
+	if _, pings, _ := p.counts(); pings != 2 {
+		t.Fatalf("关闭后规则仍被触发, 共 %d 次", pings)
+	}
+}
+
+func TestManagerAdminScope(t *testing.T) {
+	tm := newTestManager(t)
+	tm.manager.Load(context.Background(), &testPlugin{})
+
+	tests := []struct {
+		name   string
+		group  int64
+		user   int64
+		text   string
+		expect string
+	}{
+		{"普通成员", 888, 3, "/plugin disable pinger", "权限不足"},
+		{"群管理员在其他群没有管理权限", 999, 2, "/plugin disable pinger", "权限不足"},
+		{"群管理员不能管理其他群", 888, 2, "/plugin disable pinger group 999", "需要群 999 的管理员权限"},
+		{"群管理员不能管理用户范围", 888, 2, "/plugin disable pinger user 3", "需要全局管理员权限"},
+		{"群管理员可以指定本群", 888, 2, "/plugin disable pinger group 888", "已在群 888 禁用"},
+		{"主人可以管理其他群", 888, 1, "/plugin enable pinger group 999", "已在群 999 启用"},
+		{"主人可以管理用户范围", 888, 1, "/plugin disable pinger user 3", "已在用户 3 禁用"},
+		{"群管理员可以查看列表", 888, 2, "/plugin list", "pinger 1.0 [禁用]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reply := tm.send(tt.group, tt.user, tt.text); !strings.Contains(reply, tt.expect) {
+				t.Fatalf("%s 回复 = %q, 期望包含 %q", tt.text, reply, tt.expect)
+			}
+		})
+	}
+}
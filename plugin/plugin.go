@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"qq_bot/command"
+	"qq_bot/config"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"qq_bot/service/outbox"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Meta 插件元信息
+type Meta struct {
+	Name              string // 插件名称（唯一，用于启用/禁用命令）
+	Description       string // 插件说明
+	Version           string // 插件版本
+	DisabledByDefault bool   // 默认禁用，需管理员在群/私聊中手动启用
+}
+
+// Plugin 插件接口
+type Plugin interface {
+	// Meta 返回插件元信息
+	Meta() Meta
+	// Init 初始化插件，在此通过 Context 注册处理规则
+	Init(ctx context.Context, pc *Context) error
+	// Shutdown 程序关闭时释放资源
+	Shutdown(ctx context.Context) error
+}
+
+// Factory 插件创建函数（每个账号创建独立的插件实例）
+type Factory func() Plugin
+
+var (
+	registryMu sync.Mutex
+	registry   = make([]Factory, 0)
+)
+
+// Register 注册插件，通常在插件包的 init 中调用
+func Register(factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, factory)
+}
+
+// Registered 获取已注册的插件创建函数
+func Registered() []Factory {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]Factory(nil), registry...)
+}
+
+// Context 插件运行环境
+type Context struct {
+	SelfID  int64                 // 机器人QQ号
+	API     *protocol.API         // OneBot API
+	DB      *gorm.DB              // 数据库
+	Outbox  *outbox.Service       // 发件箱
+	Config  *config.Config        // 全局配置
+	Account *config.AccountConfig // 账号配置
+
+	name    string
+	manager *Manager
+}
+
+// Handle 注册插件的处理规则，插件在当前群/用户被禁用时规则不匹配
+func (c *Context) Handle(matcher event.Matcher, handler event.RuleHandler) *event.Rule {
+	return c.manager.dispatcher.Handle(event.All(c.manager.enabledMatcher(c.name), matcher), handler).Name(c.name)
+}
+
+// Command 注册插件的命令，插件在当前群/用户被禁用时命令视为不存在
+func (c *Context) Command(cmd *command.Command) error {
+	cmd.Available = c.manager.enabledMatcher(c.name)
+	return c.manager.commands.Register(cmd)
+}
+
+// WaitFor 等待同一会话中下一条满足条件的消息（见 event.Dispatcher.WaitFor）
+func (c *Context) WaitFor(ctx context.Context, e *protocol.Event, matcher event.Matcher, timeout time.Duration) (*protocol.Event, error) {
+	return c.manager.dispatcher.WaitFor(ctx, e, matcher, timeout)
+}
+
+// Reply 回复事件来源（私聊回复用户，群聊回复群），经发件箱发送
+func (c *Context) Reply(e *protocol.Event, text string) error {
+	return c.manager.reply(e, text)
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"fmt"
+	"qq_bot/protocol"
+	"qq_bot/storage"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 启用状态作用范围
+const (
+	ScopeGroup = "group"
+	ScopeUser  = "user"
+)
+
+// stateStore 插件启用状态（数据库持久化，内存缓存）
+type stateStore struct {
+	db     *gorm.DB
+	selfID int64
+	mu     sync.RWMutex
+	states map[string]bool // plugin:scope:id -> enabled
+}
+
+// newStateStore 创建状态存储并加载该账号的全部设置
+func newStateStore(db *gorm.DB, selfID int64) (*stateStore, error) {
+	s := &stateStore{
+		db:     db,
+		selfID: selfID,
+		states: make(map[string]bool),
+	}
+
+	var rows []storage.PluginState
+	if err := db.Where("self_id = ?", selfID).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("加载插件状态失败: %v", err)
+	}
+	for _, row := range rows {
+		s.states[stateKey(row.PluginName, row.ScopeType, row.ScopeId)] = row.Enabled
+	}
+	return s, nil
+}
+
+// get 获取某个范围内的设置
+func (s *stateStore) get(name, scopeType string, scopeID int64) (bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	enabled, ok := s.states[stateKey(name, scopeType, scopeID)]
+	return enabled, ok
+}
+
+// set 保存某个范围内的设置
+func (s *stateStore) set(name, scopeType string, scopeID int64, enabled bool) error {
+	row := storage.PluginState{
+		SelfId:     s.selfID,
+		PluginName: name,
+		ScopeType:  scopeType,
+		ScopeId:    scopeID,
+		Enabled:    enabled,
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "self_id"}, {Name: "plugin_name"}, {Name: "scope_type"}, {Name: "scope_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("保存插件状态失败: %v", err)
+	}
+
+	s.mu.Lock()
+	s.states[stateKey(name, scopeType, scopeID)] = enabled
+	s.mu.Unlock()
+	return nil
+}
+
+// enabled 判断插件对事件是否启用：群消息优先使用群设置，其次用户设置，最后默认值
+func (s *stateStore) enabled(name string, e *protocol.Event, def bool) bool {
+	if e.GroupID != 0 {
+		if enabled, ok := s.get(name, ScopeGroup, e.GroupID); ok {
+			return enabled
+		}
+	}
+	if e.UserID != 0 {
+		if enabled, ok := s.get(name, ScopeUser, e.UserID); ok {
+			return enabled
+		}
+	}
+	return def
+}
+
+// stateKey 缓存键
+func stateKey(name, scopeType string, scopeID int64) string {
+	return fmt.Sprintf("%s:%s:%d", name, scopeType, scopeID)
+}
@@ -0,0 +1,72 @@
+// Package dice 示例插件：掷骰子
+//
+// 演示插件的注册、命令、处理规则和按群/用户启用：默认禁用，
+// 管理员在群里发送 /plugin enable dice 后可用
+package dice
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"qq_bot/command"
+	"qq_bot/event"
+	"qq_bot/plugin"
+	"qq_bot/protocol"
+)
+
+func init() {
+	plugin.Register(func() plugin.Plugin { return &Dice{} })
+}
+
+// maxSides 骰子最大面数
+const maxSides = 1000
+
+// Dice 掷骰子插件
+type Dice struct{}
+
+// Meta 插件元信息
+func (d *Dice) Meta() plugin.Meta {
+	return plugin.Meta{
+		Name:              "dice",
+		Description:       "掷骰子",
+		Version:           "1.0",
+		DisabledByDefault: true,
+	}
+}
+
+// Init 注册 /roll 命令和“掷骰子”关键词
+func (d *Dice) Init(ctx context.Context, pc *plugin.Context) error {
+	pc.Handle(event.All(event.IsMessage(), event.Prefix("掷骰子")), func(ctx context.Context, e *protocol.Event) bool {
+		pc.Reply(e, roll(6))
+		return true
+	}).Block()
+
+	return pc.Command(&command.Command{
+		Name:        "roll",
+		Aliases:     []string{"骰子"},
+		Description: "掷骰子",
+		Args:        []command.Arg{{Name: "面数", Type: command.ArgInt, Optional: true, Desc: fmt.Sprintf("2-%d，默认6", maxSides)}},
+		Handler: func(ctx context.Context, call *command.Call) error {
+			sides := int64(6)
+			if call.Args.Has("面数") {
+				sides = call.Args.Int("面数")
+			}
+			if sides < 2 || sides > maxSides {
+				call.Reply(ctx, fmt.Sprintf("面数需要在2到%d之间", maxSides))
+				return nil
+			}
+			call.Reply(ctx, roll(sides))
+			return nil
+		},
+	})
+}
+
+// Shutdown 无需释放资源
+func (d *Dice) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// roll 掷一次骰子
+func roll(sides int64) string {
+	return fmt.Sprintf("🎲 %d（1-%d）", rand.Int63n(sides)+1, sides)
+}
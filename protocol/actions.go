@@ -0,0 +1,283 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// FlexString 兼容字符串和数字两种编码的字段（不同实现返回类型不一致）
+type FlexString string
+
+// UnmarshalJSON 解析字符串或数字
+func (f *FlexString) UnmarshalJSON(data []byte) error {
+	*f = FlexString(rawToString(bytes.TrimSpace(data)))
+	return nil
+}
+
+// MessageInfo 消息详情（get_msg）
+type MessageInfo struct {
+	Time        int64           `json:"time"`
+	MessageType string          `json:"message_type"`
+	MessageID   int32           `json:"message_id"`
+	RealID      int32           `json:"real_id"`
+	GroupID     int64           `json:"group_id,omitempty"`
+	UserID      int64           `json:"user_id,omitempty"`
+	Sender      *Sender         `json:"sender"`
+	Message     json.RawMessage `json:"message"`
+	RawMessage  string          `json:"raw_message,omitempty"`
+}
+
+// Segments 解析消息内容
+func (m *MessageInfo) Segments() MessageChain {
+	return ParseMessage(m.Message)
+}
+
+// ForwardMessage 合并转发内容（get_forward_msg）
+type ForwardMessage struct {
+	Messages []MessageInfo `json:"messages"`
+}
+
+// StrangerInfo 陌生人信息（get_stranger_info）
+type StrangerInfo struct {
+	UserID   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Sex      string `json:"sex"`
+	Age      int32  `json:"age"`
+}
+
+// FriendInfo 好友信息（get_friend_list）
+type FriendInfo struct {
+	UserID   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Remark   string `json:"remark"`
+}
+
+// GroupInfo 群信息（get_group_info）
+type GroupInfo struct {
+	GroupID        int64  `json:"group_id"`
+	GroupName      string `json:"group_name"`
+	MemberCount    int32  `json:"member_count"`
+	MaxMemberCount int32  `json:"max_member_count"`
+}
+
+// GroupMemberInfo 群成员信息（get_group_member_info/list）
+type GroupMemberInfo struct {
+	GroupID         int64      `json:"group_id"`
+	UserID          int64      `json:"user_id"`
+	Nickname        string     `json:"nickname"`
+	Card            string     `json:"card"`
+	Sex             string     `json:"sex"`
+	Age             int32      `json:"age"`
+	Area            string     `json:"area"`
+	JoinTime        int64      `json:"join_time"`
+	LastSentTime    int64      `json:"last_sent_time"`
+	Level           FlexString `json:"level"`
+	Role            string     `json:"role"` // owner/admin/member
+	Unfriendly      bool       `json:"unfriendly"`
+	Title           string     `json:"title"`
+	TitleExpireTime int64      `json:"title_expire_time"`
+	CardChangeable  bool       `json:"card_changeable"`
+}
+
+// DisplayName 群名片优先，否则昵称
+func (m *GroupMemberInfo) DisplayName() string {
+	if m.Card != "" {
+		return m.Card
+	}
+	return m.Nickname
+}
+
+// Status 运行状态（get_status）
+type Status struct {
+	Online bool `json:"online"`
+	Good   bool `json:"good"`
+}
+
+// VersionInfo 版本信息（get_version_info）
+type VersionInfo struct {
+	AppName         string `json:"app_name"`
+	AppVersion      string `json:"app_version"`
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+// DeleteMessage 撤回消息
+func (a *API) DeleteMessage(ctx context.Context, messageID int32) error {
+	return a.CallResult(ctx, "delete_msg", map[string]interface{}{
+		"message_id": messageID,
+	}, nil)
+}
+
+// GetMessage 获取消息
+func (a *API) GetMessage(ctx context.Context, messageID int32) (*MessageInfo, error) {
+	var info MessageInfo
+	err := a.CallResult(ctx, "get_msg", map[string]interface{}{
+		"message_id": messageID,
+	}, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetForwardMessage 获取合并转发内容
+func (a *API) GetForwardMessage(ctx context.Context, id string) (*ForwardMessage, error) {
+	var raw struct {
+		Messages []MessageInfo `json:"messages"`
+		// OneBot v11标准格式：node消息段数组
+		Message []struct {
+			Type string `json:"type"`
+			Data struct {
+				UserID   FlexString      `json:"user_id"`
+				Nickname string          `json:"nickname"`
+				Content  json.RawMessage `json:"content"`
+			} `json:"data"`
+		} `json:"message"`
+	}
+	err := a.CallResult(ctx, "get_forward_msg", map[string]interface{}{
+		"id": id,
+	}, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	forward := &ForwardMessage{Messages: raw.Messages}
+	if len(forward.Messages) == 0 {
+		for _, node := range raw.Message {
+			userID, _ := strconv.ParseInt(string(node.Data.UserID), 10, 64)
+			forward.Messages = append(forward.Messages, MessageInfo{
+				UserID:  userID,
+				Sender:  &Sender{UserID: userID, Nickname: node.Data.Nickname},
+				Message: node.Data.Content,
+			})
+		}
+	}
+	return forward, nil
+}
+
+// GetStrangerInfo 获取陌生人信息
+func (a *API) GetStrangerInfo(ctx context.Context, userID int64, noCache bool) (*StrangerInfo, error) {
+	var info StrangerInfo
+	err := a.CallResult(ctx, "get_stranger_info", map[string]interface{}{
+		"user_id":  userID,
+		"no_cache": noCache,
+	}, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetFriendList 获取好友列表
+func (a *API) GetFriendList(ctx context.Context) ([]FriendInfo, error) {
+	var list []FriendInfo
+	if err := a.CallResult(ctx, "get_friend_list", map[string]interface{}{}, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetGroupInfo 获取群信息
+func (a *API) GetGroupInfo(ctx context.Context, groupID int64, noCache bool) (*GroupInfo, error) {
+	var info GroupInfo
+	err := a.CallResult(ctx, "get_group_info", map[string]interface{}{
+		"group_id": groupID,
+		"no_cache": noCache,
+	}, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetGroupList 获取群列表
+func (a *API) GetGroupList(ctx context.Context) ([]GroupInfo, error) {
+	var list []GroupInfo
+	if err := a.CallResult(ctx, "get_group_list", map[string]interface{}{}, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetGroupMemberInfo 获取群成员信息
+func (a *API) GetGroupMemberInfo(ctx context.Context, groupID, userID int64, noCache bool) (*GroupMemberInfo, error) {
+	var info GroupMemberInfo
+	err := a.CallResult(ctx, "get_group_member_info", map[string]interface{}{
+		"group_id": groupID,
+		"user_id":  userID,
+		"no_cache": noCache,
+	}, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetGroupMemberList 获取群成员列表
+func (a *API) GetGroupMemberList(ctx context.Context, groupID int64) ([]GroupMemberInfo, error) {
+	var list []GroupMemberInfo
+	err := a.CallResult(ctx, "get_group_member_list", map[string]interface{}{
+		"group_id": groupID,
+	}, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SetGroupBan 群组单人禁言（duration秒，0表示解除）
+func (a *API) SetGroupBan(ctx context.Context, groupID, userID int64, duration int64) error {
+	return a.CallResult(ctx, "set_group_ban", map[string]interface{}{
+		"group_id": groupID,
+		"user_id":  userID,
+		"duration": duration,
+	}, nil)
+}
+
+// SetGroupKick 群组踢人
+func (a *API) SetGroupKick(ctx context.Context, groupID, userID int64, rejectAddRequest bool) error {
+	return a.CallResult(ctx, "set_group_kick", map[string]interface{}{
+		"group_id":           groupID,
+		"user_id":            userID,
+		"reject_add_request": rejectAddRequest,
+	}, nil)
+}
+
+// SetFriendAddRequest 处理加好友请求
+func (a *API) SetFriendAddRequest(ctx context.Context, flag string, approve bool, remark string) error {
+	return a.CallResult(ctx, "set_friend_add_request", map[string]interface{}{
+		"flag":    flag,
+		"approve": approve,
+		"remark":  remark,
+	}, nil)
+}
+
+// SetGroupAddRequest 处理加群请求/邀请（subType: add/invite，拒绝时可附带理由）
+func (a *API) SetGroupAddRequest(ctx context.Context, flag, subType string, approve bool, reason string) error {
+	return a.CallResult(ctx, "set_group_add_request", map[string]interface{}{
+		"flag":     flag,
+		"sub_type": subType,
+		"type":     subType,
+		"approve":  approve,
+		"reason":   reason,
+	}, nil)
+}
+
+// GetStatus 获取运行状态
+func (a *API) GetStatus(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := a.CallResult(ctx, "get_status", map[string]interface{}{}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetVersionInfo 获取版本信息
+func (a *API) GetVersionInfo(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if err := a.CallResult(ctx, "get_version_info", map[string]interface{}{}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
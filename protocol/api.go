@@ -1,80 +1,226 @@
 package protocol
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrTimeout API调用超时
+var ErrTimeout = errors.New("API调用超时")
+
+// APIError API返回失败
+type APIError struct {
+	Action  string
+	Status  string
+	RetCode int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API %s 调用失败: status=%s, retcode=%d, message=%s", e.Action, e.Status, e.RetCode, e.Message)
+}
+
 // API OneBot API封装
 type API struct {
-	sender func([]byte) error
+	sender  func(context.Context, []byte) error
+	format  string // 发送消息格式 array/string
+	napcat  bool   // 是否为NapCat（启用扩展动作）
+	timeout time.Duration
+	echoSeq uint64
+	prefix  string
+	mu      sync.Mutex
+	pending map[string]chan *Response // echo -> 等待中的调用
 }
 
 // NewAPI 创建API实例
-func NewAPI(sender func([]byte) error) *API {
-	return &API{sender: sender}
+func NewAPI(sender func(context.Context, []byte) error) *API {
+	return &API{
+		sender:  sender,
+		format:  FormatArray,
+		timeout: 10 * time.Second,
+		prefix:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		pending: make(map[string]chan *Response),
+	}
+}
+
+// SetTimeout 设置默认调用超时（上下文没有截止时间时生效）
+func (a *API) SetTimeout(timeout time.Duration) {
+	a.timeout = timeout
+}
+
+// SetMessageFormat 设置发送消息格式（对应NapCat的message_format）
+func (a *API) SetMessageFormat(format string) {
+	if format == "" {
+		format = FormatArray
+	}
+	a.format = format
+}
+
+// formatMessage 将消息段按配置的格式转换，其他类型原样发送
+func (a *API) formatMessage(message interface{}) interface{} {
+	switch m := message.(type) {
+	case MessageChain:
+		return FormatMessage(m, a.format)
+	case []Segment:
+		return FormatMessage(MessageChain(m), a.format)
+	case *MessageBuilder:
+		return FormatMessage(m.Build(), a.format)
+	default:
+		return message
+	}
 }
 
 // SendPrivateMessage 发送私聊消息
-func (a *API) SendPrivateMessage(userID int64, message interface{}) error {
-	req := SendMessageReq{
-		Action: "send_private_msg",
-		Params: map[string]interface{}{
-			"user_id": userID,
-			"message": message,
-		},
+func (a *API) SendPrivateMessage(ctx context.Context, userID int64, message interface{}) (*SendMessageResult, error) {
+	var result SendMessageResult
+	err := a.CallResult(ctx, "send_private_msg", map[string]interface{}{
+		"user_id": userID,
+		"message": a.formatMessage(message),
+	}, &result)
+	if err != nil {
+		return nil, err
 	}
-	return a.sendRequest(req)
+	return &result, nil
 }
 
 // SendGroupMessage 发送群消息
-func (a *API) SendGroupMessage(groupID int64, message interface{}) error {
-	req := SendMessageReq{
-		Action: "send_group_msg",
-		Params: map[string]interface{}{
-			"group_id": groupID,
-			"message":  message,
-		},
+func (a *API) SendGroupMessage(ctx context.Context, groupID int64, message interface{}) (*SendMessageResult, error) {
+	var result SendMessageResult
+	err := a.CallResult(ctx, "send_group_msg", map[string]interface{}{
+		"group_id": groupID,
+		"message":  a.formatMessage(message),
+	}, &result)
+	if err != nil {
+		return nil, err
 	}
-	return a.sendRequest(req)
+	return &result, nil
 }
 
 // SendMessage 发送消息（自动判断类型）
-func (a *API) SendMessage(messageType string, id int64, message interface{}) error {
+func (a *API) SendMessage(ctx context.Context, messageType string, id int64, message interface{}) (*SendMessageResult, error) {
 	if messageType == "private" {
-		return a.SendPrivateMessage(id, message)
+		return a.SendPrivateMessage(ctx, id, message)
 	}
-	return a.SendGroupMessage(id, message)
+	return a.SendGroupMessage(ctx, id, message)
 }
 
 // GetLoginInfo 获取登录信息
-func (a *API) GetLoginInfo() error {
+func (a *API) GetLoginInfo(ctx context.Context) (*LoginInfo, error) {
+	var info LoginInfo
+	if err := a.CallResult(ctx, "get_login_info", map[string]interface{}{}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CallResult 调用API并将data解析到result
+func (a *API) CallResult(ctx context.Context, action string, params map[string]interface{}, result interface{}) error {
+	resp, err := a.Call(ctx, action, params)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(resp.Data) == 0 || string(resp.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Data, result); err != nil {
+		return fmt.Errorf("解析 %s 响应失败: %v", action, err)
+	}
+	return nil
+}
+
+// Call 调用API并等待响应
+func (a *API) Call(ctx context.Context, action string, params map[string]interface{}) (*Response, error) {
+	if _, ok := ctx.Deadline(); !ok && a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+
+	echo := a.nextEcho()
+	ch := make(chan *Response, 1)
+
+	a.mu.Lock()
+	a.pending[echo] = ch
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, echo)
+		a.mu.Unlock()
+	}()
+
 	req := SendMessageReq{
-		Action: "get_login_info",
-		Params: map[string]interface{}{},
+		Action: action,
+		Params: params,
+		Echo:   echo,
+	}
+	if err := a.sendRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Status == "failed" || resp.RetCode != 0 {
+			msg := resp.Wording
+			if msg == "" {
+				msg = resp.Message
+			}
+			return resp, &APIError{Action: action, Status: resp.Status, RetCode: resp.RetCode, Message: msg}
+		}
+		return resp, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %s", ErrTimeout, action)
+		}
+		return nil, ctx.Err()
 	}
-	return a.sendRequest(req)
+}
+
+// HandleResponse 处理API响应（由连接层调用），返回是否匹配到等待中的调用
+func (a *API) HandleResponse(resp *Response) bool {
+	if resp == nil || resp.Echo == "" {
+		return false
+	}
+
+	a.mu.Lock()
+	ch, ok := a.pending[resp.Echo]
+	a.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	select {
+	case ch <- resp:
+	default:
+	}
+	return true
+}
+
+// nextEcho 生成唯一的echo标识
+func (a *API) nextEcho() string {
+	seq := atomic.AddUint64(&a.echoSeq, 1)
+	return a.prefix + "-" + strconv.FormatUint(seq, 10)
 }
 
 // sendRequest 发送请求
-func (a *API) sendRequest(req SendMessageReq) error {
+func (a *API) sendRequest(ctx context.Context, req SendMessageReq) error {
 	data, err := json.Marshal(req)
 	if err != nil {
 		return fmt.Errorf("marshal request error: %v", err)
 	}
-	return a.sender(data)
+	return a.sender(ctx, data)
 }
 
 // BuildArrayMessage 构建array格式消息
-func BuildArrayMessage(text string) []Message {
-	return []Message{
-		{
-			Type: "text",
-			Data: map[string]interface{}{
-				"text": text,
-			},
-		},
-	}
+func BuildArrayMessage(text string) MessageChain {
+	return NewMessage().Text(text).Build()
 }
 
 // BuildTextMessage 构建纯文本消息
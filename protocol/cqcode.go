@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"sort"
+	"strings"
+)
+
+// 消息格式
+const (
+	FormatArray  = "array"
+	FormatString = "string"
+)
+
+var (
+	cqTextEscaper   = strings.NewReplacer("&", "&amp;", "[", "&#91;", "]", "&#93;")
+	cqParamEscaper  = strings.NewReplacer("&", "&amp;", "[", "&#91;", "]", "&#93;", ",", "&#44;")
+	cqUnescaper     = strings.NewReplacer("&#91;", "[", "&#93;", "]", "&#44;", ",", "&amp;", "&")
+	cqSegmentPrefix = "[CQ:"
+)
+
+// EscapeCQText 转义CQ码中的纯文本
+func EscapeCQText(s string) string {
+	return cqTextEscaper.Replace(s)
+}
+
+// EscapeCQParam 转义CQ码参数值（额外转义逗号）
+func EscapeCQParam(s string) string {
+	return cqParamEscaper.Replace(s)
+}
+
+// UnescapeCQ 反转义CQ码
+func UnescapeCQ(s string) string {
+	return cqUnescaper.Replace(s)
+}
+
+// ParseCQ 将CQ码字符串解析为消息段，格式错误的CQ码按纯文本处理
+func ParseCQ(s string) MessageChain {
+	chain := make(MessageChain, 0)
+
+	appendText := func(text string) {
+		if text == "" {
+			return
+		}
+		text = UnescapeCQ(text)
+		// 合并相邻文本段
+		if n := len(chain); n > 0 {
+			if prev, ok := chain[n-1].(TextSegment); ok {
+				chain[n-1] = TextSegment{Text: prev.Text + text}
+				return
+			}
+		}
+		chain = append(chain, TextSegment{Text: text})
+	}
+
+	for len(s) > 0 {
+		start := strings.Index(s, cqSegmentPrefix)
+		if start < 0 {
+			appendText(s)
+			break
+		}
+		end := strings.IndexByte(s[start:], ']')
+		if end < 0 {
+			appendText(s)
+			break
+		}
+		end += start
+
+		appendText(s[:start])
+
+		if seg, ok := parseCQSegment(s[start+len(cqSegmentPrefix) : end]); ok {
+			chain = append(chain, seg)
+		} else {
+			appendText(s[start : end+1])
+		}
+		s = s[end+1:]
+	}
+
+	return chain
+}
+
+// parseCQSegment 解析CQ码内部 "type,k=v,k=v"
+func parseCQSegment(body string) (Segment, bool) {
+	parts := strings.Split(body, ",")
+	segType := strings.TrimSpace(parts[0])
+	if segType == "" {
+		return nil, false
+	}
+
+	data := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || key == "" {
+			return nil, false
+		}
+		data[key] = UnescapeCQ(value)
+	}
+	return NewSegment(segType, data), true
+}
+
+// EncodeCQ 将消息段编码为CQ码字符串
+func EncodeCQ(chain MessageChain) string {
+	var sb strings.Builder
+	for _, seg := range chain {
+		if text, ok := seg.(TextSegment); ok {
+			sb.WriteString(EscapeCQText(text.Text))
+			continue
+		}
+
+		sb.WriteString(cqSegmentPrefix)
+		sb.WriteString(seg.Type())
+
+		data := seg.Params()
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			sb.WriteString(",")
+			sb.WriteString(k)
+			sb.WriteString("=")
+			sb.WriteString(EscapeCQParam(data[k]))
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+// CQString 编码为CQ码字符串
+func (c MessageChain) CQString() string {
+	return EncodeCQ(c)
+}
+
+// FormatMessage 按消息格式转换消息：string格式编码为CQ码，array格式保持消息段
+func FormatMessage(chain MessageChain, format string) interface{} {
+	if format == FormatString {
+		return EncodeCQ(chain)
+	}
+	return chain
+}
@@ -0,0 +1,131 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCQ(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want MessageChain
+	}{
+		{
+			name: "纯文本",
+			in:   "你好",
+			want: MessageChain{TextSegment{Text: "你好"}},
+		},
+		{
+			name: "文本转义",
+			in:   "a&amp;b&#91;c&#93;d&#44;e",
+			want: MessageChain{TextSegment{Text: "a&b[c]d,e"}},
+		},
+		{
+			name: "转义后的实体不再二次反转义",
+			in:   "&amp;#91;",
+			want: MessageChain{TextSegment{Text: "&#91;"}},
+		},
+		{
+			name: "@和文本",
+			in:   "[CQ:at,qq=10001] 在吗",
+			want: MessageChain{AtSegment{QQ: "10001"}, TextSegment{Text: " 在吗"}},
+		},
+		{
+			name: "参数值中的逗号和括号",
+			in:   "[CQ:image,file=a.jpg,url=http://x/?a=1&#44;b=2&amp;c=&#91;3&#93;]",
+			want: MessageChain{ImageSegment{File: "a.jpg", URL: "http://x/?a=1,b=2&c=[3]"}},
+		},
+		{
+			name: "参数值中的等号",
+			in:   "[CQ:json,data={\"k\"=1}]",
+			want: MessageChain{JSONSegment{Data: "{\"k\"=1}"}},
+		},
+		{
+			name: "文本中的单独左括号",
+			in:   "a[b [CQ:face,id=14]c[",
+			want: MessageChain{TextSegment{Text: "a[b "}, FaceSegment{ID: "14"}, TextSegment{Text: "c["}},
+		},
+		{
+			name: "未闭合的CQ码按文本处理",
+			in:   "前[CQ:face,id=14",
+			want: MessageChain{TextSegment{Text: "前[CQ:face,id=14"}},
+		},
+		{
+			name: "格式错误的CQ码按文本处理并与相邻文本合并",
+			in:   "a[CQ:,id=1]b[CQ:face,bad]c",
+			want: MessageChain{TextSegment{Text: "a[CQ:,id=1]b[CQ:face,bad]c"}},
+		},
+		{
+			name: "未知类型",
+			in:   "[CQ:markdown,content=hi]",
+			want: MessageChain{UnknownSegment{SegType: "markdown", Data: map[string]string{"content": "hi"}}},
+		},
+		{
+			name: "空字符串",
+			in:   "",
+			want: MessageChain{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseCQ(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseCQ(%q)\n得到 %#v\n期望 %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeCQ(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain MessageChain
+		want  string
+	}{
+		{
+			name:  "文本转义（逗号不转义）",
+			chain: MessageChain{TextSegment{Text: "a&b[c]d,e"}},
+			want:  "a&amp;b&#91;c&#93;d,e",
+		},
+		{
+			name:  "参数按键名排序并转义逗号",
+			chain: MessageChain{ImageSegment{URL: "http://x/?a=1,b=[2]", File: "a&b.jpg"}},
+			want:  "[CQ:image,file=a&amp;b.jpg,url=http://x/?a=1&#44;b=&#91;2&#93;]",
+		},
+		{
+			name:  "@和回复",
+			chain: NewMessage().Reply(42).At(10001).Text(" 你好").Build(),
+			want:  "[CQ:reply,id=42][CQ:at,qq=10001] 你好",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EncodeCQ(tt.chain)
+			if got != tt.want {
+				t.Fatalf("EncodeCQ = %q, 期望 %q", got, tt.want)
+			}
+			if back := ParseCQ(got); !reflect.DeepEqual(back, tt.chain) {
+				t.Fatalf("往返得到 %#v, 期望 %#v", back, tt.chain)
+			}
+		})
+	}
+}
+
+func TestCQRoundTripText(t *testing.T) {
+	// 用户输入的任意文本经编码再解析后保持不变
+	for _, text := range []string{
+		"[CQ:face,id=1]",
+		"&#91;&#93;&#44;&amp;",
+		"a,b=c]d[",
+		"[[[]]]",
+		"&",
+	} {
+		chain := MessageChain{TextSegment{Text: text}}
+		if back := ParseCQ(EncodeCQ(chain)); !reflect.DeepEqual(back, chain) {
+			t.Errorf("文本 %q 往返得到 %#v", text, back)
+		}
+	}
+}
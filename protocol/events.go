@@ -0,0 +1,154 @@
+package protocol
+
+import "encoding/json"
+
+// TypedEvent 具体类型的事件，均内嵌原始 *Event
+type TypedEvent interface {
+	// EventName 事件名（post_type.细分类型），零值也可调用
+	EventName() string
+	// Raw 获取原始事件
+	Raw() *Event
+}
+
+// PrivateMessageEvent 私聊消息
+type PrivateMessageEvent struct{ *Event }
+
+// GroupMessageEvent 群消息
+type GroupMessageEvent struct{ *Event }
+
+// MessageSentEvent 机器人自己发出的消息（NapCat上报自身消息时）
+type MessageSentEvent struct{ *Event }
+
+// GroupRecallNotice 群消息撤回（OperatorID为撤回者，UserID为消息发送者）
+type GroupRecallNotice struct{ *Event }
+
+// FriendRecallNotice 好友消息撤回
+type FriendRecallNotice struct{ *Event }
+
+// GroupIncreaseNotice 群成员增加（SubType: approve/invite）
+type GroupIncreaseNotice struct{ *Event }
+
+// GroupDecreaseNotice 群成员减少（SubType: leave/kick/kick_me）
+type GroupDecreaseNotice struct{ *Event }
+
+// PokeNotice 戳一戳（UserID为发起者，TargetID为被戳者，GroupID为0表示私聊）
+type PokeNotice struct{ *Event }
+
+// FriendAddNotice 新好友已添加
+type FriendAddNotice struct{ *Event }
+
+// FriendRequest 加好友请求
+type FriendRequest struct{ *Event }
+
+// GroupRequest 加群请求/邀请（SubType: add/invite）
+type GroupRequest struct{ *Event }
+
+// LifecycleMetaEvent 生命周期（SubType: enable/disable/connect）
+type LifecycleMetaEvent struct{ *Event }
+
+// HeartbeatMetaEvent 心跳
+type HeartbeatMetaEvent struct{ *Event }
+
+// UnknownEvent 未细分的事件
+type UnknownEvent struct{ *Event }
+
+func (e PrivateMessageEvent) EventName() string { return "message.private" }
+func (e GroupMessageEvent) EventName() string   { return "message.group" }
+func (e MessageSentEvent) EventName() string    { return "message_sent" }
+func (e GroupRecallNotice) EventName() string   { return "notice.group_recall" }
+func (e FriendRecallNotice) EventName() string  { return "notice.friend_recall" }
+func (e GroupIncreaseNotice) EventName() string { return "notice.group_increase" }
+func (e GroupDecreaseNotice) EventName() string { return "notice.group_decrease" }
+func (e PokeNotice) EventName() string          { return "notice.notify.poke" }
+func (e FriendAddNotice) EventName() string     { return "notice.friend_add" }
+func (e FriendRequest) EventName() string       { return "request.friend" }
+func (e GroupRequest) EventName() string        { return "request.group" }
+func (e LifecycleMetaEvent) EventName() string  { return "meta_event.lifecycle" }
+func (e HeartbeatMetaEvent) EventName() string  { return "meta_event.heartbeat" }
+func (e UnknownEvent) EventName() string        { return "unknown" }
+
+func (e PrivateMessageEvent) Raw() *Event { return e.Event }
+func (e GroupMessageEvent) Raw() *Event   { return e.Event }
+func (e MessageSentEvent) Raw() *Event    { return e.Event }
+func (e GroupRecallNotice) Raw() *Event   { return e.Event }
+func (e FriendRecallNotice) Raw() *Event  { return e.Event }
+func (e GroupIncreaseNotice) Raw() *Event { return e.Event }
+func (e GroupDecreaseNotice) Raw() *Event { return e.Event }
+func (e PokeNotice) Raw() *Event          { return e.Event }
+func (e FriendAddNotice) Raw() *Event     { return e.Event }
+func (e FriendRequest) Raw() *Event       { return e.Event }
+func (e GroupRequest) Raw() *Event        { return e.Event }
+func (e LifecycleMetaEvent) Raw() *Event  { return e.Event }
+func (e HeartbeatMetaEvent) Raw() *Event  { return e.Event }
+func (e UnknownEvent) Raw() *Event        { return e.Event }
+
+// IsGroup 是否为群内戳一戳
+func (e PokeNotice) IsGroup() bool {
+	return e.GroupID != 0
+}
+
+// Online 心跳上报的QQ在线状态
+func (e HeartbeatMetaEvent) Online() bool {
+	if status, ok := e.Status.(map[string]interface{}); ok {
+		if online, ok := status["online"].(bool); ok {
+			return online
+		}
+	}
+	return true
+}
+
+// Typed 将事件转换为具体类型
+func (e *Event) Typed() TypedEvent {
+	switch e.PostType {
+	case "message":
+		switch e.MessageType {
+		case "private":
+			return PrivateMessageEvent{e}
+		case "group":
+			return GroupMessageEvent{e}
+		}
+	case "message_sent":
+		return MessageSentEvent{e}
+	case "notice":
+		switch e.NoticeType {
+		case "group_recall":
+			return GroupRecallNotice{e}
+		case "friend_recall":
+			return FriendRecallNotice{e}
+		case "group_increase":
+			return GroupIncreaseNotice{e}
+		case "group_decrease":
+			return GroupDecreaseNotice{e}
+		case "friend_add":
+			return FriendAddNotice{e}
+		case "notify":
+			if e.SubType == "poke" {
+				return PokeNotice{e}
+			}
+		}
+	case "request":
+		switch e.RequestType {
+		case "friend":
+			return FriendRequest{e}
+		case "group":
+			return GroupRequest{e}
+		}
+	case "meta_event":
+		switch e.MetaEventType {
+		case "lifecycle":
+			return LifecycleMetaEvent{e}
+		case "heartbeat":
+			return HeartbeatMetaEvent{e}
+		}
+	}
+	return UnknownEvent{e}
+}
+
+// ParseEvent 将原始数据帧解码为具体类型的事件
+func ParseEvent(data []byte) (TypedEvent, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return event.Typed(), nil
+}
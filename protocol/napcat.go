@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrUnsupported 当前OneBot实现不支持该动作（NapCat扩展动作）
+var ErrUnsupported = errors.New("当前OneBot实现不支持该动作")
+
+// 输入状态（set_input_status的event_type）
+const (
+	InputStatusSpeaking = 0 // 对方正在说话
+	InputStatusTyping   = 1 // 对方正在输入
+)
+
+// DetectCapabilities 通过get_version_info识别OneBot实现，决定是否启用NapCat扩展动作
+func (a *API) DetectCapabilities(ctx context.Context) (*VersionInfo, error) {
+	info, err := a.GetVersionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.napcat = strings.Contains(strings.ToLower(info.AppName), "napcat")
+	a.mu.Unlock()
+	return info, nil
+}
+
+// IsNapCat 是否已识别为NapCat
+func (a *API) IsNapCat() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.napcat
+}
+
+// callNapCat 调用NapCat扩展动作，非NapCat时返回ErrUnsupported
+func (a *API) callNapCat(ctx context.Context, action string, params map[string]interface{}, result interface{}) error {
+	if !a.IsNapCat() {
+		return ErrUnsupported
+	}
+	return a.CallResult(ctx, action, params, result)
+}
+
+// SetInputStatus 设置私聊输入状态（显示"对方正在输入"）
+func (a *API) SetInputStatus(ctx context.Context, userID int64, status int) error {
+	return a.callNapCat(ctx, "set_input_status", map[string]interface{}{
+		"user_id":    userID,
+		"event_type": status,
+	}, nil)
+}
+
+// FriendPoke 私聊戳一戳
+func (a *API) FriendPoke(ctx context.Context, userID int64) error {
+	return a.callNapCat(ctx, "friend_poke", map[string]interface{}{
+		"user_id": userID,
+	}, nil)
+}
+
+// GroupPoke 群内戳一戳
+func (a *API) GroupPoke(ctx context.Context, groupID, userID int64) error {
+	return a.callNapCat(ctx, "group_poke", map[string]interface{}{
+		"group_id": groupID,
+		"user_id":  userID,
+	}, nil)
+}
+
+// SetMessageEmojiLike 给消息贴表情（set为false时取消）
+func (a *API) SetMessageEmojiLike(ctx context.Context, messageID int32, emojiID string, set bool) error {
+	return a.callNapCat(ctx, "set_msg_emoji_like", map[string]interface{}{
+		"message_id": messageID,
+		"emoji_id":   emojiID,
+		"set":        set,
+	}, nil)
+}
+
+// MarkPrivateMessageAsRead 标记私聊消息已读
+func (a *API) MarkPrivateMessageAsRead(ctx context.Context, userID int64) error {
+	return a.callNapCat(ctx, "mark_private_msg_as_read", map[string]interface{}{
+		"user_id": userID,
+	}, nil)
+}
+
+// MarkGroupMessageAsRead 标记群消息已读
+func (a *API) MarkGroupMessageAsRead(ctx context.Context, groupID int64) error {
+	return a.callNapCat(ctx, "mark_group_msg_as_read", map[string]interface{}{
+		"group_id": groupID,
+	}, nil)
+}
+
+// GetFriendMessageHistory 获取私聊历史消息（messageSeq为0时从最新开始）
+func (a *API) GetFriendMessageHistory(ctx context.Context, userID int64, messageSeq int32, count int, reverseOrder bool) ([]MessageInfo, error) {
+	var result struct {
+		Messages []MessageInfo `json:"messages"`
+	}
+	err := a.callNapCat(ctx, "get_friend_msg_history", map[string]interface{}{
+		"user_id":      userID,
+		"message_seq":  messageSeq,
+		"count":        count,
+		"reverseOrder": reverseOrder,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Messages, nil
+}
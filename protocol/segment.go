@@ -0,0 +1,436 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 消息段类型
+const (
+	SegmentText    = "text"
+	SegmentFace    = "face"
+	SegmentAt      = "at"
+	SegmentReply   = "reply"
+	SegmentImage   = "image"
+	SegmentRecord  = "record"
+	SegmentVideo   = "video"
+	SegmentFile    = "file"
+	SegmentForward = "forward"
+	SegmentJSON    = "json"
+	SegmentXML     = "xml"
+	SegmentPoke    = "poke"
+	SegmentMFace   = "mface"
+)
+
+// Segment 消息段
+type Segment interface {
+	Type() string
+	// Params 消息段的data字段，统一为字符串形式（JSON和CQ码共用）
+	Params() map[string]string
+}
+
+// TextSegment 纯文本
+type TextSegment struct {
+	Text string
+}
+
+// FaceSegment QQ表情
+type FaceSegment struct {
+	ID string
+}
+
+// AtSegment @某人（QQ为"all"表示全体成员）
+type AtSegment struct {
+	QQ   string
+	Name string
+}
+
+// ReplySegment 回复
+type ReplySegment struct {
+	ID string
+}
+
+// ImageSegment 图片
+type ImageSegment struct {
+	File    string
+	URL     string
+	Summary string
+	SubType string
+	Flash   bool
+}
+
+// RecordSegment 语音
+type RecordSegment struct {
+	File  string
+	URL   string
+	Magic bool
+}
+
+// VideoSegment 短视频
+type VideoSegment struct {
+	File  string
+	URL   string
+	Thumb string
+}
+
+// FileSegment 文件
+type FileSegment struct {
+	File     string
+	Name     string
+	URL      string
+	FileID   string
+	FileSize string
+}
+
+// ForwardSegment 合并转发
+type ForwardSegment struct {
+	ID string
+}
+
+// JSONSegment JSON卡片消息
+type JSONSegment struct {
+	Data string
+}
+
+// XMLSegment XML卡片消息
+type XMLSegment struct {
+	Data string
+}
+
+// PokeSegment 戳一戳
+type PokeSegment struct {
+	PokeType string
+	ID       string
+}
+
+// MFaceSegment 商城表情
+type MFaceSegment struct {
+	EmojiPackageID string
+	EmojiID        string
+	Key            string
+	Summary        string
+	URL            string
+}
+
+// UnknownSegment 未识别的消息段（原样保留）
+type UnknownSegment struct {
+	SegType string
+	Data    map[string]string
+}
+
+func (s TextSegment) Type() string    { return SegmentText }
+func (s FaceSegment) Type() string    { return SegmentFace }
+func (s AtSegment) Type() string      { return SegmentAt }
+func (s ReplySegment) Type() string   { return SegmentReply }
+func (s ImageSegment) Type() string   { return SegmentImage }
+func (s RecordSegment) Type() string  { return SegmentRecord }
+func (s VideoSegment) Type() string   { return SegmentVideo }
+func (s FileSegment) Type() string    { return SegmentFile }
+func (s ForwardSegment) Type() string { return SegmentForward }
+func (s JSONSegment) Type() string    { return SegmentJSON }
+func (s XMLSegment) Type() string     { return SegmentXML }
+func (s PokeSegment) Type() string    { return SegmentPoke }
+func (s MFaceSegment) Type() string   { return SegmentMFace }
+func (s UnknownSegment) Type() string { return s.SegType }
+
+func (s TextSegment) Params() map[string]string {
+	return map[string]string{"text": s.Text}
+}
+
+func (s FaceSegment) Params() map[string]string {
+	return params("id", s.ID)
+}
+
+func (s AtSegment) Params() map[string]string {
+	return params("qq", s.QQ, "name", s.Name)
+}
+
+func (s ReplySegment) Params() map[string]string {
+	return params("id", s.ID)
+}
+
+func (s ImageSegment) Params() map[string]string {
+	p := params("file", s.File, "url", s.URL, "summary", s.Summary, "sub_type", s.SubType)
+	if s.Flash {
+		p["type"] = "flash"
+	}
+	return p
+}
+
+func (s RecordSegment) Params() map[string]string {
+	p := params("file", s.File, "url", s.URL)
+	if s.Magic {
+		p["magic"] = "1"
+	}
+	return p
+}
+
+func (s VideoSegment) Params() map[string]string {
+	return params("file", s.File, "url", s.URL, "thumb", s.Thumb)
+}
+
+func (s FileSegment) Params() map[string]string {
+	return params("file", s.File, "name", s.Name, "url", s.URL, "file_id", s.FileID, "file_size", s.FileSize)
+}
+
+func (s ForwardSegment) Params() map[string]string {
+	return params("id", s.ID)
+}
+
+func (s JSONSegment) Params() map[string]string {
+	return params("data", s.Data)
+}
+
+func (s XMLSegment) Params() map[string]string {
+	return params("data", s.Data)
+}
+
+func (s PokeSegment) Params() map[string]string {
+	return params("type", s.PokeType, "id", s.ID)
+}
+
+func (s MFaceSegment) Params() map[string]string {
+	return params("emoji_package_id", s.EmojiPackageID, "emoji_id", s.EmojiID,
+		"key", s.Key, "summary", s.Summary, "url", s.URL)
+}
+
+func (s UnknownSegment) Params() map[string]string {
+	return s.Data
+}
+
+// params 构建data字段，忽略空值
+func params(kv ...string) map[string]string {
+	p := make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			p[kv[i]] = kv[i+1]
+		}
+	}
+	return p
+}
+
+// NewSegment 根据类型和data字段创建消息段
+func NewSegment(segType string, data map[string]string) Segment {
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	switch segType {
+	case SegmentText:
+		return TextSegment{Text: data["text"]}
+	case SegmentFace:
+		return FaceSegment{ID: data["id"]}
+	case SegmentAt:
+		return AtSegment{QQ: data["qq"], Name: data["name"]}
+	case SegmentReply:
+		return ReplySegment{ID: data["id"]}
+	case SegmentImage:
+		return ImageSegment{
+			File:    data["file"],
+			URL:     data["url"],
+			Summary: data["summary"],
+			SubType: data["sub_type"],
+			Flash:   data["type"] == "flash",
+		}
+	case SegmentRecord:
+		return RecordSegment{File: data["file"], URL: data["url"], Magic: data["magic"] == "1" || data["magic"] == "true"}
+	case SegmentVideo:
+		return VideoSegment{File: data["file"], URL: data["url"], Thumb: data["thumb"]}
+	case SegmentFile:
+		return FileSegment{
+			File:     data["file"],
+			Name:     data["name"],
+			URL:      data["url"],
+			FileID:   data["file_id"],
+			FileSize: data["file_size"],
+		}
+	case SegmentForward:
+		return ForwardSegment{ID: data["id"]}
+	case SegmentJSON:
+		return JSONSegment{Data: data["data"]}
+	case SegmentXML:
+		return XMLSegment{Data: data["data"]}
+	case SegmentPoke:
+		return PokeSegment{PokeType: data["type"], ID: data["id"]}
+	case SegmentMFace:
+		return MFaceSegment{
+			EmojiPackageID: data["emoji_package_id"],
+			EmojiID:        data["emoji_id"],
+			Key:            data["key"],
+			Summary:        data["summary"],
+			URL:            data["url"],
+		}
+	default:
+		return UnknownSegment{SegType: segType, Data: data}
+	}
+}
+
+// MessageChain 消息段列表
+type MessageChain []Segment
+
+// MarshalJSON 编码为OneBot array格式
+func (c MessageChain) MarshalJSON() ([]byte, error) {
+	wire := make([]Message, 0, len(c))
+	for _, seg := range c {
+		data := seg.Params()
+		if data == nil {
+			data = map[string]string{}
+		}
+		wire = append(wire, Message{Type: seg.Type(), Data: data})
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON 从OneBot array格式解码
+func (c *MessageChain) UnmarshalJSON(data []byte) error {
+	var wire []struct {
+		Type string                     `json:"type"`
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	chain := make(MessageChain, 0, len(wire))
+	for _, w := range wire {
+		params := make(map[string]string, len(w.Data))
+		for k, v := range w.Data {
+			params[k] = rawToString(v)
+		}
+		chain = append(chain, NewSegment(w.Type, params))
+	}
+	*c = chain
+	return nil
+}
+
+// rawToString 将data字段的值统一转为字符串（NapCat部分字段为数字）
+func rawToString(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+	}
+	return string(raw)
+}
+
+// PlainText 拼接所有文本段
+func (c MessageChain) PlainText() string {
+	var sb strings.Builder
+	for _, seg := range c {
+		if text, ok := seg.(TextSegment); ok {
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
+
+// Mentions 检查是否@了某人
+func (c MessageChain) Mentions(qq int64) bool {
+	target := strconv.FormatInt(qq, 10)
+	for _, seg := range c {
+		if at, ok := seg.(AtSegment); ok && at.QQ == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplyID 获取回复的消息ID（没有回复段时返回false）
+func (c MessageChain) ReplyID() (int32, bool) {
+	for _, seg := range c {
+		if reply, ok := seg.(ReplySegment); ok {
+			id, err := strconv.ParseInt(reply.ID, 10, 32)
+			if err != nil {
+				return 0, false
+			}
+			return int32(id), true
+		}
+	}
+	return 0, false
+}
+
+// Has 检查是否包含某类型的消息段
+func (c MessageChain) Has(segType string) bool {
+	for _, seg := range c {
+		if seg.Type() == segType {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageBuilder 消息构建器
+type MessageBuilder struct {
+	chain MessageChain
+}
+
+// NewMessage 创建消息构建器
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{chain: make(MessageChain, 0)}
+}
+
+// Text 追加文本
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	return b.Append(TextSegment{Text: text})
+}
+
+// Textf 追加格式化文本
+func (b *MessageBuilder) Textf(format string, v ...interface{}) *MessageBuilder {
+	return b.Text(fmt.Sprintf(format, v...))
+}
+
+// Face 追加QQ表情
+func (b *MessageBuilder) Face(id int) *MessageBuilder {
+	return b.Append(FaceSegment{ID: strconv.Itoa(id)})
+}
+
+// At 追加@某人
+func (b *MessageBuilder) At(qq int64) *MessageBuilder {
+	return b.Append(AtSegment{QQ: strconv.FormatInt(qq, 10)})
+}
+
+// AtAll 追加@全体成员
+func (b *MessageBuilder) AtAll() *MessageBuilder {
+	return b.Append(AtSegment{QQ: "all"})
+}
+
+// Reply 追加回复（OneBot要求回复段在最前，这里自动插到开头）
+func (b *MessageBuilder) Reply(messageID int32) *MessageBuilder {
+	seg := ReplySegment{ID: strconv.FormatInt(int64(messageID), 10)}
+	b.chain = append(MessageChain{seg}, b.chain...)
+	return b
+}
+
+// Image 追加图片（file支持本地路径、URL、base64://）
+func (b *MessageBuilder) Image(file string) *MessageBuilder {
+	return b.Append(ImageSegment{File: file})
+}
+
+// Record 追加语音
+func (b *MessageBuilder) Record(file string) *MessageBuilder {
+	return b.Append(RecordSegment{File: file})
+}
+
+// Video 追加短视频
+func (b *MessageBuilder) Video(file string) *MessageBuilder {
+	return b.Append(VideoSegment{File: file})
+}
+
+// Append 追加任意消息段
+func (b *MessageBuilder) Append(segments ...Segment) *MessageBuilder {
+	b.chain = append(b.chain, segments...)
+	return b
+}
+
+// Build 生成消息
+func (b *MessageBuilder) Build() MessageChain {
+	return b.chain
+}
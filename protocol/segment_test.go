@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMessageChainUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want MessageChain
+	}{
+		{
+			name: "字符串data",
+			raw:  `[{"type":"at","data":{"qq":"10001"}},{"type":"text","data":{"text":" 你好"}}]`,
+			want: MessageChain{AtSegment{QQ: "10001"}, TextSegment{Text: " 你好"}},
+		},
+		{
+			name: "数字qq和id",
+			raw:  `[{"type":"reply","data":{"id":-2147000001}},{"type":"at","data":{"qq":10001}},{"type":"face","data":{"id":14}}]`,
+			want: MessageChain{ReplySegment{ID: "-2147000001"}, AtSegment{QQ: "10001"}, FaceSegment{ID: "14"}},
+		},
+		{
+			name: "null和缺少data",
+			raw:  `[{"type":"image","data":{"file":"a.jpg","url":null}},{"type":"poke"}]`,
+			want: MessageChain{ImageSegment{File: "a.jpg"}, PokeSegment{}},
+		},
+		{
+			name: "未知类型保留原始字段",
+			raw:  `[{"type":"markdown","data":{"content":"# 标题","level":1}}]`,
+			want: MessageChain{UnknownSegment{SegType: "markdown", Data: map[string]string{"content": "# 标题", "level": "1"}}},
+		},
+		{
+			name: "空数组",
+			raw:  `[]`,
+			want: MessageChain{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got MessageChain
+			if err := json.Unmarshal([]byte(tt.raw), &got); err != nil {
+				t.Fatalf("解码失败: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("解码 %s\n得到 %#v\n期望 %#v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageChainRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain MessageChain
+		wire  string
+	}{
+		{
+			name:  "文本和@",
+			chain: NewMessage().At(10001).Text("在吗").Build(),
+			wire:  `[{"type":"at","data":{"qq":"10001"}},{"type":"text","data":{"text":"在吗"}}]`,
+		},
+		{
+			name:  "回复和表情",
+			chain: NewMessage().Reply(123).Face(14).Build(),
+			wire:  `[{"type":"reply","data":{"id":"123"}},{"type":"face","data":{"id":"14"}}]`,
+		},
+		{
+			name:  "闪照",
+			chain: MessageChain{ImageSegment{File: "a.jpg", Flash: true}},
+			wire:  `[{"type":"image","data":{"file":"a.jpg","type":"flash"}}]`,
+		},
+		{
+			name:  "空文本保留text字段",
+			chain: MessageChain{TextSegment{}},
+			wire:  `[{"type":"text","data":{"text":""}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.chain)
+			if err != nil {
+				t.Fatalf("编码失败: %v", err)
+			}
+			if string(data) != tt.wire {
+				t.Fatalf("编码得到 %s, 期望 %s", data, tt.wire)
+			}
+
+			var back MessageChain
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatalf("解码失败: %v", err)
+			}
+			if !reflect.DeepEqual(back, tt.chain) {
+				t.Fatalf("往返得到 %#v, 期望 %#v", back, tt.chain)
+			}
+		})
+	}
+}
+
+func TestMessageChainHelpers(t *testing.T) {
+	chain := ParseMessage(json.RawMessage(`[{"type":"reply","data":{"id":42}},{"type":"at","data":{"qq":10001}},{"type":"text","data":{"text":" 晚上好"}}]`))
+
+	if !chain.Mentions(10001) || chain.Mentions(10002) {
+		t.Errorf("Mentions 结果错误: %#v", chain)
+	}
+	if id, ok := chain.ReplyID(); !ok || id != 42 {
+		t.Errorf("ReplyID = %d, %v, 期望 42", id, ok)
+	}
+	if text := chain.PlainText(); text != " 晚上好" {
+		t.Errorf("PlainText = %q", text)
+	}
+	if !chain.Has(SegmentAt) || chain.Has(SegmentImage) {
+		t.Errorf("Has 结果错误")
+	}
+}
@@ -1,30 +1,62 @@
 package protocol
 
-// Message OneBot消息结构
+import "encoding/json"
+
+// Message OneBot消息段的传输结构
 type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type string            `json:"type"`
+	Data map[string]string `json:"data"`
 }
 
 // Event OneBot事件结构
 type Event struct {
-	Time          int64       `json:"time"`
-	SelfID        int64       `json:"self_id"`
-	PostType      string      `json:"post_type"`
-	MessageType   string      `json:"message_type,omitempty"`
-	SubType       string      `json:"sub_type,omitempty"`
-	MessageID     int32       `json:"message_id,omitempty"`
-	UserID        int64       `json:"user_id,omitempty"`
-	GroupID       int64       `json:"group_id,omitempty"`
-	Message       interface{} `json:"message,omitempty"`
-	RawMessage    string      `json:"raw_message,omitempty"`
-	Font          int32       `json:"font,omitempty"`
-	Sender        *Sender     `json:"sender,omitempty"`
-	NoticeType    string      `json:"notice_type,omitempty"`
-	RequestType   string      `json:"request_type,omitempty"`
-	MetaEventType string      `json:"meta_event_type,omitempty"`
-	Interval      int64       `json:"interval,omitempty"`
-	Status        interface{} `json:"status,omitempty"`
+	Time          int64           `json:"time"`
+	SelfID        int64           `json:"self_id"`
+	PostType      string          `json:"post_type"`
+	MessageType   string          `json:"message_type,omitempty"`
+	SubType       string          `json:"sub_type,omitempty"`
+	MessageID     int32           `json:"message_id,omitempty"`
+	UserID        int64           `json:"user_id,omitempty"`
+	GroupID       int64           `json:"group_id,omitempty"`
+	Message       json.RawMessage `json:"message,omitempty"`
+	RawMessage    string          `json:"raw_message,omitempty"`
+	Font          int32           `json:"font,omitempty"`
+	Sender        *Sender         `json:"sender,omitempty"`
+	NoticeType    string          `json:"notice_type,omitempty"`
+	RequestType   string          `json:"request_type,omitempty"`
+	MetaEventType string          `json:"meta_event_type,omitempty"`
+	Interval      int64           `json:"interval,omitempty"`
+	Status        interface{}     `json:"status,omitempty"`
+	OperatorID    int64           `json:"operator_id,omitempty"` // 操作者QQ号（撤回、进退群等）
+	TargetID      int64           `json:"target_id,omitempty"`   // 目标QQ号（戳一戳、自己发出的消息）
+	SenderID      int64           `json:"sender_id,omitempty"`   // 戳一戳发起者（部分实现）
+	Duration      int64           `json:"duration,omitempty"`    // 禁言时长(秒)
+	Flag          string          `json:"flag,omitempty"`        // 请求标识（处理加好友/加群请求时使用）
+	Comment       string          `json:"comment,omitempty"`     // 验证信息
+	RawInfo       json.RawMessage `json:"raw_info,omitempty"`    // 戳一戳动作信息（NapCat扩展）
+}
+
+// Segments 解析消息内容为消息段（兼容array和string两种上报格式）
+func (e *Event) Segments() MessageChain {
+	return ParseMessage(e.Message)
+}
+
+// ParseMessage 解析JSON编码的消息：数组按消息段解析，字符串按CQ码解析
+func ParseMessage(raw json.RawMessage) MessageChain {
+	if len(raw) == 0 {
+		return MessageChain{}
+	}
+
+	var chain MessageChain
+	if err := json.Unmarshal(raw, &chain); err == nil {
+		return chain
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return ParseCQ(text)
+	}
+	return MessageChain{}
 }
 
 // Sender 发送者信息
@@ -44,8 +76,48 @@ type SendMessageReq struct {
 
 // Response API响应
 type Response struct {
-	Status  string      `json:"status"`
-	RetCode int         `json:"retcode"`
-	Data    interface{} `json:"data,omitempty"`
-	Echo    string      `json:"echo,omitempty"`
+	Status  string          `json:"status"`
+	RetCode int             `json:"retcode"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Wording string          `json:"wording,omitempty"`
+	Echo    string          `json:"echo,omitempty"`
+}
+
+// SendMessageResult 发送消息结果
+type SendMessageResult struct {
+	MessageID int32 `json:"message_id"`
+}
+
+// LoginInfo 登录号信息
+type LoginInfo struct {
+	UserID   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+}
+
+// ParseFrame 解析收到的数据帧，区分API响应和事件
+// 带有echo或retcode且没有post_type的帧视为API响应
+func ParseFrame(data []byte) (*Event, *Response, error) {
+	var probe struct {
+		PostType string          `json:"post_type"`
+		Echo     json.RawMessage `json:"echo"`
+		RetCode  *int            `json:"retcode"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, nil, err
+	}
+
+	if probe.PostType == "" && (probe.Echo != nil || probe.RetCode != nil) {
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, nil, err
+		}
+		return nil, &resp, nil
+	}
+
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, nil, err
+	}
+	return &event, nil, nil
 }
@@ -0,0 +1,48 @@
+package protocol
+
+import "testing"
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		frame    string
+		response bool
+		echo     string
+		postType string
+	}{
+		{name: "成功响应", frame: `{"status":"ok","retcode":0,"data":{"message_id":1},"echo":"abc-1"}`, response: true, echo: "abc-1"},
+		{name: "失败响应", frame: `{"status":"failed","retcode":1404,"data":null,"message":"不支持","echo":"abc-2"}`, response: true, echo: "abc-2"},
+		{name: "没有echo的响应", frame: `{"status":"failed","retcode":1400}`, response: true},
+		{name: "消息事件", frame: `{"time":1,"self_id":10001,"post_type":"message","message_type":"private","user_id":123456,"message":[]}`, postType: "message"},
+		{name: "心跳事件带status", frame: `{"time":1,"self_id":10001,"post_type":"meta_event","meta_event_type":"heartbeat","status":{"online":true}}`, postType: "meta_event"},
+		{name: "带post_type和echo的帧按事件处理", frame: `{"post_type":"notice","notice_type":"poke","echo":"x"}`, postType: "notice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, resp, err := ParseFrame([]byte(tt.frame))
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if tt.response {
+				if resp == nil || event != nil {
+					t.Fatalf("期望API响应, 得到 event=%+v resp=%+v", event, resp)
+				}
+				if resp.Echo != tt.echo {
+					t.Fatalf("echo = %q, 期望 %q", resp.Echo, tt.echo)
+				}
+				return
+			}
+			if event == nil || resp != nil {
+				t.Fatalf("期望事件, 得到 event=%+v resp=%+v", event, resp)
+			}
+			if event.PostType != tt.postType {
+				t.Fatalf("post_type = %q, 期望 %q", event.PostType, tt.postType)
+			}
+		})
+	}
+
+	if _, _, err := ParseFrame([]byte(`not json`)); err == nil {
+		t.Fatal("无效JSON应返回错误")
+	}
+}
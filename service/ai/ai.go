@@ -11,7 +11,7 @@ import (
 
 // AIService AI服务接口
 type AIService interface {
-	ChatWithHistory(messages []openai.ChatCompletionMessage) (string, error)
+	ChatWithHistory(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error)
 }
 
 // OpenAIService OpenAI兼容服务
@@ -35,7 +35,7 @@ func NewOpenAIService(cfg *config.AIConfig) *OpenAIService {
 }
 
 // ChatWithHistory 带历史记录的对话
-func (s *OpenAIService) ChatWithHistory(messages []openai.ChatCompletionMessage) (string, error) {
+func (s *OpenAIService) ChatWithHistory(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
 	req := openai.ChatCompletionRequest{
 		Model:       s.config.Model,
 		Messages:    messages,
@@ -43,9 +43,10 @@ func (s *OpenAIService) ChatWithHistory(messages []openai.ChatCompletionMessage)
 		Temperature: float32(s.config.Temperature),
 	}
 
-	utils.Debug("发送AI请求: %d条消息", len(messages))
+	log := utils.Log(ctx)
+	log.Debug("发送AI请求: %d条消息", len(messages))
 
-	resp, err := s.client.CreateChatCompletion(context.Background(), req)
+	resp, err := s.client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("AI请求失败: %v", err)
 	}
@@ -55,7 +56,7 @@ func (s *OpenAIService) ChatWithHistory(messages []openai.ChatCompletionMessage)
 	}
 
 	reply := resp.Choices[0].Message.Content
-	utils.Debug("AI回复: %s", reply)
+	log.Debug("AI回复: %s", reply)
 
 	return reply, nil
 }
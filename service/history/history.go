@@ -1,22 +1,35 @@
 package history
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"qq_bot/storage"
+	"qq_bot/utils"
+	"strings"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"gorm.io/gorm"
 )
 
+// purgeInterval 软删除记录清理间隔
+const purgeInterval = time.Hour
+
+// ErrNothingToRestore 没有可撤销的清空操作
+var ErrNothingToRestore = errors.New("没有可撤销的清空操作")
+
 // HistoryService 对话历史服务
 type HistoryService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	selfID int64 // 所属机器人QQ号
 }
 
 // NewHistoryService 创建历史服务
-func NewHistoryService() *HistoryService {
+func NewHistoryService(selfID int64) *HistoryService {
 	return &HistoryService{
-		db: storage.GetDB(),
+		db:     storage.GetDB(),
+		selfID: selfID,
 	}
 }
 
@@ -28,6 +41,7 @@ func (s *HistoryService) SaveMessage(qqId int64, groupId *int64, role string, co
 // SaveMessageWithMetadata 保存带元数据的消息
 func (s *HistoryService) SaveMessageWithMetadata(qqId int64, groupId *int64, role string, content string, metadata map[string]interface{}) error {
 	history := storage.ChatHistory{
+		SelfId:   s.selfID,
 		QQId:     qqId,
 		GroupId:  groupId,
 		Role:     role, // user/assistant/utils
@@ -37,11 +51,77 @@ func (s *HistoryService) SaveMessageWithMetadata(qqId int64, groupId *int64, rol
 	return s.db.Create(&history).Error
 }
 
+// SaveGroupMessage 保存群聊记录
+// qqId为对话对象：群友消息为发送者本人，机器人的回复为被回复的用户（关系评估按用户取历史）
+func (s *HistoryService) SaveGroupMessage(groupId, qqId, senderId int64, senderName, role, content string) error {
+	history := storage.ChatHistory{
+		SelfId:     s.selfID,
+		QQId:       qqId,
+		GroupId:    &groupId,
+		SenderId:   senderId,
+		SenderName: senderName,
+		Role:       role,
+		Content:    content,
+	}
+	return s.db.Create(&history).Error
+}
+
+// GetGroupTranscript 获取群内所有人最近的聊天记录（按时间正序）
+func (s *HistoryService) GetGroupTranscript(groupId int64, limit int) ([]storage.ChatHistory, error) {
+	var histories []storage.ChatHistory
+	err := s.db.Where("self_id = ? AND group_id = ?", s.selfID, groupId).
+		Order("created_at DESC").Limit(limit).Find(&histories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(histories)-1; i < j; i, j = i+1, j-1 {
+		histories[i], histories[j] = histories[j], histories[i]
+	}
+	return histories, nil
+}
+
+// RenderTranscript 将群聊记录转换为对话消息：群友的连续发言合并为一条，每行“昵称: 内容”
+func RenderTranscript(histories []storage.ChatHistory) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0)
+	var lines []string
+
+	flush := func() {
+		if len(lines) > 0 {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: strings.Join(lines, "\n"),
+			})
+			lines = nil
+		}
+	}
+
+	for _, h := range histories {
+		if h.Role == openai.ChatMessageRoleAssistant {
+			flush()
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: h.Content,
+			})
+			continue
+		}
+
+		name := h.SenderName
+		if name == "" {
+			name = fmt.Sprintf("QQ%d", h.QQId)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", name, h.Content))
+	}
+	flush()
+
+	return messages
+}
+
 // GetRecentHistory 获取最近的对话历史（限制条数）
 func (s *HistoryService) GetRecentHistory(qqId int64, groupId *int64, limit int) ([]openai.ChatCompletionMessage, error) {
 	var histories []storage.ChatHistory
 
-	query := s.db.Where("qq_id = ?", qqId)
+	query := s.db.Where("self_id = ? AND qq_id = ?", s.selfID, qqId)
 	if groupId != nil {
 		query = query.Where("group_id = ?", *groupId)
 	} else {
@@ -66,15 +146,17 @@ func (s *HistoryService) GetRecentHistory(qqId int64, groupId *int64, limit int)
 	return messages, nil
 }
 
-// CleanOldHistory 清理旧的历史记录（防止数据库膨胀）
-func (s *HistoryService) CleanOldHistory(days int) error {
+// CleanOldHistory 清理旧的历史记录（防止数据库膨胀），返回删除条数
+func (s *HistoryService) CleanOldHistory(days int) (int64, error) {
 	cutoff := time.Now().AddDate(0, 0, -days)
-	return s.db.Where("created_at < ?", cutoff).Delete(&storage.ChatHistory{}).Error
+	result := s.db.Unscoped().Where("self_id = ? AND created_at < ?", s.selfID, cutoff).Delete(&storage.ChatHistory{})
+	return result.RowsAffected, result.Error
 }
 
-// ClearUserHistory 清空用户历史（用户主动清空）
+// ClearUserHistory 清空用户在某个会话中的历史（用户主动清空，不可撤销）
+// groupId为nil时清空私聊历史，否则清空该用户在该群的历史
 func (s *HistoryService) ClearUserHistory(qqId int64, groupId *int64) error {
-	query := s.db.Where("qq_id = ?", qqId)
+	query := s.db.Unscoped().Where("self_id = ? AND qq_id = ?", s.selfID, qqId)
 	if groupId != nil {
 		query = query.Where("group_id = ?", *groupId)
 	} else {
@@ -83,7 +165,66 @@ func (s *HistoryService) ClearUserHistory(qqId int64, groupId *int64) error {
 	return query.Delete(&storage.ChatHistory{}).Error
 }
 
-// ClearAllHistory 清空所有聊天记录
-func (s *HistoryService) ClearAllHistory() error {
-	return s.db.Exec("TRUNCATE TABLE chat_histories").Error
+// ClearAllHistory 软删除该账号的全部聊天记录（可通过 RestoreAllHistory 撤销），返回删除条数
+func (s *HistoryService) ClearAllHistory() (int64, error) {
+	result := s.db.Where("self_id = ?", s.selfID).Delete(&storage.ChatHistory{})
+	return result.RowsAffected, result.Error
+}
+
+// RestoreAllHistory 撤销最近一次全部清空（需在window时间内），返回恢复条数
+func (s *HistoryService) RestoreAllHistory(window time.Duration) (int64, error) {
+	var latest struct {
+		DeletedAt *time.Time
+	}
+	err := s.db.Unscoped().Model(&storage.ChatHistory{}).
+		Select("MAX(deleted_at) AS deleted_at").
+		Where("self_id = ? AND deleted_at IS NOT NULL", s.selfID).
+		Scan(&latest).Error
+	if err != nil {
+		return 0, err
+	}
+	if latest.DeletedAt == nil || time.Since(*latest.DeletedAt) > window {
+		return 0, ErrNothingToRestore
+	}
+
+	// 同一次清空的记录删除时间相同
+	result := s.db.Unscoped().Model(&storage.ChatHistory{}).
+		Where("self_id = ? AND deleted_at = ?", s.selfID, *latest.DeletedAt).
+		Update("deleted_at", nil)
+	return result.RowsAffected, result.Error
+}
+
+// PurgeDeleted 彻底删除软删除超过window时间的记录，返回删除条数
+func (s *HistoryService) PurgeDeleted(window time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-window)
+	result := s.db.Unscoped().Where("self_id = ? AND deleted_at < ?", s.selfID, cutoff).Delete(&storage.ChatHistory{})
+	return result.RowsAffected, result.Error
+}
+
+// RunPurge 定期彻底删除过期的软删除记录和超过保留天数的历史记录，直到ctx取消
+func (s *HistoryService) RunPurge(ctx context.Context, window time.Duration, retentionDays int) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.PurgeDeleted(window)
+		if err != nil {
+			utils.Error("清理已删除的历史记录失败: %v", err)
+		} else if count > 0 {
+			utils.Info("已彻底删除%d条过期的历史记录", count)
+		}
+
+		count, err = s.CleanOldHistory(retentionDays)
+		if err != nil {
+			utils.Error("清理超过保留天数的历史记录失败: %v", err)
+		} else if count > 0 {
+			utils.Info("已删除%d条超过%d天的历史记录", count, retentionDays)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,148 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"qq_bot/command"
+	"qq_bot/event"
+	"qq_bot/service/history"
+	"qq_bot/utils"
+	"time"
+)
+
+// confirmTimeout 等待确认回复的时间
+const confirmTimeout = 60 * time.Second
+
+// RegisterCommands 注册基础命令
+func (s *MessageService) RegisterCommands(r *command.Registry) {
+	r.MustRegister(&command.Command{
+		Name:        "ping",
+		Description: "测试连接",
+		Handler: func(ctx context.Context, call *command.Call) error {
+			call.Reply(ctx, "pong!")
+			return nil
+		},
+	})
+	r.MustRegister(&command.Command{
+		Name:        "about",
+		Description: "关于本机器人",
+		Handler: func(ctx context.Context, call *command.Call) error {
+			call.Reply(ctx, "NapCat QQ机器人 v2.0\n基于Go语言开发\n支持AI对话和上下文记忆")
+			return nil
+		},
+	})
+	r.MustRegister(&command.Command{
+		Name:        "clear",
+		Description: "清空你在当前会话的对话历史",
+		Args: []command.Arg{
+			{Name: "选项", Optional: true, Choices: []string{"reset"}, Desc: "reset 同时重置你在当前会话的关系（熟悉度、信任度、亲密度）"},
+		},
+		Usage:   "私聊中清空私聊历史，群聊中只清空你在本群的历史，需要回复“确认”",
+		Handler: s.handleClearHistory,
+	})
+	r.MustRegister(&command.Command{
+		Name:        "wipe",
+		Description: "清空本账号所有用户的对话历史",
+		Args: []command.Arg{
+			{Name: "操作", Optional: true, Choices: []string{"undo"}, Desc: "undo 撤销最近一次清空"},
+		},
+		Usage:   fmt.Sprintf("清空后%s内可撤销，之后彻底删除", formatWindow(s.undoWindow)),
+		Level:   command.LevelOwner,
+		Handler: s.handleWipeHistory,
+	})
+}
+
+// handleClearHistory 清空调用者在当前会话的历史（可选重置关系）
+func (s *MessageService) handleClearHistory(ctx context.Context, call *command.Call) error {
+	e := call.Event
+	reset := call.Args.String("选项") == "reset"
+
+	var groupId *int64
+	where := "私聊"
+	if e.MessageType == "group" {
+		groupId = &e.GroupID
+		where = "本群"
+	}
+
+	prompt := fmt.Sprintf("确定要清空你在%s的对话历史吗？", where)
+	if reset {
+		prompt = fmt.Sprintf("确定要清空你在%s的对话历史，并重置我们在%s的关系吗？", where, where)
+	}
+	if !s.confirm(ctx, call, prompt) {
+		return nil
+	}
+
+	if err := s.historyService.ClearUserHistory(e.UserID, groupId); err != nil {
+		return fmt.Errorf("清空历史失败: %v", err)
+	}
+	if !reset {
+		call.Reply(ctx, "已清空你的对话历史")
+		return nil
+	}
+
+	if err := s.relationshipService.ResetRelationship(e.UserID, groupId); err != nil {
+		return fmt.Errorf("重置关系失败: %v", err)
+	}
+	call.Reply(ctx, "已清空你的对话历史并重置关系")
+	return nil
+}
+
+// handleWipeHistory 清空本账号全部历史（软删除），或撤销最近一次清空
+func (s *MessageService) handleWipeHistory(ctx context.Context, call *command.Call) error {
+	log := utils.Log(ctx)
+
+	if call.Args.String("操作") == "undo" {
+		count, err := s.historyService.RestoreAllHistory(s.undoWindow)
+		if errors.Is(err, history.ErrNothingToRestore) {
+			call.Reply(ctx, fmt.Sprintf("%s内没有可撤销的清空操作", formatWindow(s.undoWindow)))
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("恢复历史失败: %v", err)
+		}
+		log.Info("QQ=%d 撤销清空，恢复%d条历史记录", call.Event.UserID, count)
+		call.Reply(ctx, fmt.Sprintf("已恢复%d条对话历史", count))
+		return nil
+	}
+
+	if !s.confirm(ctx, call, "确定要清空本账号所有用户的对话历史吗？") {
+		return nil
+	}
+
+	count, err := s.historyService.ClearAllHistory()
+	if err != nil {
+		return fmt.Errorf("清空历史失败: %v", err)
+	}
+	log.Info("QQ=%d 清空全部历史，共%d条", call.Event.UserID, count)
+	call.Reply(ctx, fmt.Sprintf("已清空%d条对话历史，%s内可使用 /wipe undo 撤销", count, formatWindow(s.undoWindow)))
+	return nil
+}
+
+// confirm 请求调用者确认，回复“确认”时返回true
+func (s *MessageService) confirm(ctx context.Context, call *command.Call, prompt string) bool {
+	call.Reply(ctx, prompt+"\n回复“确认”继续，其他回复取消")
+
+	reply, err := s.dispatcher.WaitFor(ctx, call.Event, nil, confirmTimeout)
+	if errors.Is(err, event.ErrWaitTimeout) {
+		call.Reply(ctx, "等待确认超时，已取消")
+		return false
+	}
+	if err != nil {
+		return false
+	}
+
+	if event.MessageText(reply) != "确认" {
+		call.Reply(ctx, "已取消")
+		return false
+	}
+	return true
+}
+
+// formatWindow 格式化时间窗口
+func formatWindow(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d小时", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%d分钟", int(d/time.Minute))
+}
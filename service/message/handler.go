@@ -1,12 +1,18 @@
 package message
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"qq_bot/command"
+	"qq_bot/config"
+	"qq_bot/event"
 	"qq_bot/protocol"
 	"qq_bot/service/ai"
 	"qq_bot/service/history"
+	"qq_bot/service/outbox"
+	"qq_bot/service/permission"
 	"qq_bot/service/relationship"
-	"qq_bot/service/user"
 	"qq_bot/utils"
 	"strings"
 	"time"
@@ -17,131 +23,232 @@ import (
 // MessageService 消息服务
 type MessageService struct {
 	api                 *protocol.API
+	outbox              *outbox.Service
 	aiService           ai.AIService
-	userService         *user.UserService
+	permission          *permission.Service
 	historyService      *history.HistoryService
 	relationshipService *relationship.Service
+	dispatcher          *event.Dispatcher // 用于等待确认回复
+	undoWindow          time.Duration     // 全局清空可撤销时间
+	groupContext        int               // 群聊记录条数
+	burstWindows        []time.Duration   // 各关系阶段的连续消息等待时间
+	burstMaxWait        time.Duration     // 最长聚合时间
 }
 
 // NewMessageService 创建消息服务
-func NewMessageService(api *protocol.API, aiService ai.AIService, relationshipService *relationship.Service, allowedQQs []int64) *MessageService {
+func NewMessageService(selfID int64, api *protocol.API, outboxService *outbox.Service, aiService ai.AIService, relationshipService *relationship.Service, historyCfg *config.HistoryConfig, burstCfg *config.BurstConfig, permissionService *permission.Service) *MessageService {
 	return &MessageService{
 		api:                 api,
+		outbox:              outboxService,
 		aiService:           aiService,
-		userService:         user.NewUserService(allowedQQs),
-		historyService:      history.NewHistoryService(),
+		permission:          permissionService,
+		historyService:      history.NewHistoryService(selfID),
 		relationshipService: relationshipService,
+		undoWindow:          historyCfg.GetUndoWindow(),
+		groupContext:        historyCfg.GetGroupContext(),
+		burstWindows:        burstCfg.GetWindows(),
+		burstMaxWait:        burstCfg.GetMaxWait(),
 	}
 }
 
-// HandleMessage 处理消息事件
-func (s *MessageService) HandleMessage(event *protocol.Event) {
-	if event.PostType != "message" {
-		return
-	}
+// Register 注册消息处理规则：权限过滤 -> (命令，见 RegisterCommands) -> 群聊记录 -> AI对话
+func (s *MessageService) Register(d *event.Dispatcher) {
+	s.dispatcher = d
+	// 群聊记录在权限过滤和命令之前执行，群里所有人的发言都进入记录
+	d.Handle(event.All(event.Group(), event.Not(event.Prefix(command.Prefix))), s.recordGroupMessage).Priority(-10).Name("群聊记录")
+	d.Handle(event.IsMessage(), s.filterMessage).Priority(0).Name("消息过滤")
+	d.Handle(event.IsMessage(), s.handleAIChat).Priority(event.FallbackPriority).Block().Name("AI对话")
+}
+
+// Reply 回复消息（支持 </> 分段）
+func (s *MessageService) Reply(ctx context.Context, e *protocol.Event, text string) {
+	s.sendReply(ctx, e, text)
+}
 
-	// 获取消息文本
-	msgText := event.RawMessage
+// filterMessage 过滤空消息和无权使用的用户的消息，返回true表示忽略
+func (s *MessageService) filterMessage(ctx context.Context, e *protocol.Event) bool {
+	// 获取消息文本（兼容array和string两种上报格式）
+	msgText := event.MessageText(e)
 	if msgText == "" {
-		return
+		return true
 	}
 
-	userName := getUserName(event)
-	utils.Info("收到消息: [%s] %s(%d): %s", event.MessageType, userName, event.UserID, msgText)
+	log := utils.Log(ctx)
+	userName := getUserName(e)
+	log.Info("收到消息: [%s] %s(%d): %s", e.MessageType, userName, e.UserID, msgText)
 
-	// 检查QQ号是否在白名单中
-	if !s.userService.CheckPermission(event.UserID) {
-		utils.Debug("QQ号 %d 不在白名单中，忽略消息", event.UserID)
-		return // 直接忽略，不做任何回应
+	// 检查权限（封禁、未授权用户和黑名单群）
+	if !s.permission.Allowed(e) {
+		log.Debug("QQ号 %d 无权使用，忽略消息", e.UserID)
+		return true // 直接忽略，不做任何回应
 	}
 
-	// 处理命令
-	if strings.HasPrefix(msgText, "/") {
-		s.handleCommand(event, msgText)
-		return
-	}
+	// 标记已读（后台执行，不受本事件处理结束影响）
+	readCtx, cancel := event.Detach(ctx)
+	go func() {
+		defer cancel()
+		s.markRead(readCtx, e)
+	}()
+	return false
+}
 
-	// 权限已在上面检查过，这里不需要再检查
+// groupChatNote 群聊时追加到系统提示词的说明
+const groupChatNote = "\n\n你正在群聊中，下面是最近的群聊记录，群友的发言格式为“昵称: 内容”。请以你的身份回复 %s 的最新消息，回复内容不要带昵称前缀。"
 
-	// 普通消息，调用AI回复
-	s.handleAIChat(event, msgText)
+// recordGroupMessage 记录群消息到群聊记录（无论发送者是否有权使用、是否回复），继续传播
+// 黑名单群和封禁用户的消息不记录
+func (s *MessageService) recordGroupMessage(ctx context.Context, e *protocol.Event) bool {
+	text := event.MessageText(e)
+	if text == "" {
+		return false
+	}
+	if s.permission.GroupMode(e.GroupID) == permission.GroupBlock || s.permission.EventRole(e) == permission.RoleBanned {
+		return false
+	}
+	if err := s.historyService.SaveGroupMessage(e.GroupID, e.UserID, e.UserID, getUserName(e), "user", text); err != nil {
+		utils.Log(ctx).Error("保存群聊记录失败: %v", err)
+	}
+	return false
 }
 
-// handleCommand 处理命令
-func (s *MessageService) handleCommand(event *protocol.Event, cmd string) {
-	parts := strings.Fields(cmd)
-	if len(parts) == 0 {
-		return
+// saveUserMessage 保存用户消息到历史（群消息保存为群聊记录）
+func (s *MessageService) saveUserMessage(ctx context.Context, e *protocol.Event, text string) {
+	var err error
+	if e.MessageType == "group" {
+		err = s.historyService.SaveGroupMessage(e.GroupID, e.UserID, e.UserID, getUserName(e), "user", text)
+	} else {
+		err = s.historyService.SaveMessage(e.UserID, nil, "user", text)
+	}
+	if err != nil {
+		utils.Log(ctx).Error("保存用户消息失败: %v", err)
+	}
+}
+
+// collectBurst 收集用户连续发送的消息（每条都保存到历史），用户停顿超过等待时间后返回合并的文本
+// 等待时间按关系阶段决定，命令不参与聚合
+func (s *MessageService) collectBurst(ctx context.Context, e *protocol.Event, first string) string {
+	window := s.burstWindow(e)
+	if window <= 0 {
+		return first
+	}
+
+	log := utils.Log(ctx)
+	texts := []string{first}
+	add := func(next *protocol.Event) {
+		text := event.MessageText(next)
+		if text == "" {
+			return
+		}
+		log.Info("收到连续消息: [%s] %s(%d): %s", next.MessageType, getUserName(next), next.UserID, text)
+		s.saveUserMessage(ctx, next, text)
+		texts = append(texts, text)
+	}
+
+	// 整个等待期间保持订阅，保存消息时到达的新消息也会被拦截，不会触发另一次回复
+	sub := s.dispatcher.Subscribe(e, event.All(event.IsMessage(), event.Not(event.Prefix(command.Prefix))))
+	deadline := time.Now().Add(s.burstMaxWait)
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		if wait > window {
+			wait = window
+		}
+
+		next, err := sub.Next(ctx, wait)
+		if err != nil {
+			break
+		}
+		add(next)
 	}
 
-	command := parts[0]
+	// 停止等待前已拦截的消息也合并到本次回复
+	for _, next := range sub.Close() {
+		add(next)
+	}
 
-	switch command {
-	case "/help":
-		s.handleHelp(event)
-	case "/ping":
-		s.sendReply(event, "pong!")
-	case "/about":
-		s.sendReply(event, "NapCat QQ机器人 v2.0\n基于Go语言开发\n支持AI对话和上下文记忆")
-	case "/clear":
-		s.handleClearHistory(event)
-	default:
-		s.sendReply(event, "未知命令: "+command+"\n输入 /help 查看可用命令")
+	if len(texts) > 1 {
+		log.Debug("合并%d条连续消息", len(texts))
 	}
+	return strings.Join(texts, "\n")
 }
 
-// handleHelp 处理帮助命令
-func (s *MessageService) handleHelp(event *protocol.Event) {
-	help := "可用命令:\n"
-	help += "/help - 显示帮助\n"
-	help += "/ping - 测试连接\n"
-	help += "/about - 关于本机器人\n"
-	help += "/clear - 清空对话历史\n"
+// burstWindow 根据关系阶段获取连续消息等待时间
+func (s *MessageService) burstWindow(e *protocol.Event) time.Duration {
+	if len(s.burstWindows) == 0 {
+		return 0
+	}
+
+	var groupId *int64
+	if e.MessageType == "group" {
+		groupId = &e.GroupID
+	}
 
-	s.sendReply(event, help)
+	stage := 1
+	if rel, err := s.relationshipService.GetRelationshipStatus(e.UserID, groupId); err == nil {
+		stage = rel.Stage
+	}
+
+	index := stage - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(s.burstWindows) {
+		index = len(s.burstWindows) - 1
+	}
+	return s.burstWindows[index]
 }
 
-// handleClearHistory 清空历史
-func (s *MessageService) handleClearHistory(event *protocol.Event) {
-	err := s.historyService.ClearAllHistory()
+// groupTranscript 获取群聊记录并渲染为对话消息
+func (s *MessageService) groupTranscript(groupID int64) ([]openai.ChatCompletionMessage, error) {
+	histories, err := s.historyService.GetGroupTranscript(groupID, s.groupContext)
 	if err != nil {
-		utils.Error("清空历史失败: %v", err)
-		s.sendReply(event, "清空历史失败")
-		return
+		return nil, err
 	}
-
-	s.sendReply(event, "已清空所有对话历史")
+	return history.RenderTranscript(histories), nil
 }
 
 // handleAIChat 处理AI对话
-func (s *MessageService) handleAIChat(event *protocol.Event, userMessage string) {
+func (s *MessageService) handleAIChat(ctx context.Context, e *protocol.Event) bool {
+	log := utils.Log(ctx)
 	if s.aiService == nil {
-		utils.Debug("AI服务未配置，跳过")
-		return
+		log.Debug("AI服务未配置，跳过")
+		return false
 	}
 
+	userMessage := strings.TrimSpace(e.Segments().PlainText())
+
 	var groupId *int64
-	if event.MessageType == "group" {
-		groupId = &event.GroupID
+	if e.MessageType == "group" {
+		groupId = &e.GroupID
 	}
 
-	// 保存用户消息
-	err := s.historyService.SaveMessage(event.UserID, groupId, "user", userMessage)
-	if err != nil {
-		utils.Error("保存用户消息失败: %v", err)
+	// 保存用户消息（群消息已由群聊记录保存）
+	if groupId == nil {
+		s.saveUserMessage(ctx, e, userMessage)
 	}
 
+	// 等待用户发完连续的几条消息，合并为一次回复
+	userMessage = s.collectBurst(ctx, e, userMessage)
+
 	// 获取动态系统提示词（基于关系阶段）
-	systemPrompt, err := s.relationshipService.GetStagePrompt(event.UserID, groupId)
+	systemPrompt, err := s.relationshipService.GetStagePrompt(ctx, e.UserID, groupId)
 	if err != nil {
-		utils.Error("获取阶段提示词失败: %v", err)
+		log.Error("获取阶段提示词失败: %v", err)
 		systemPrompt = "你是一个友好的AI助手。" // 降级默认值
 	}
 
-	// 获取历史记录
-	historyMessages, err := s.historyService.GetRecentHistory(event.UserID, groupId, 200) // 获取最近200条（100轮对话）
+	// 获取历史记录：私聊为与该用户的对话，群聊为群内所有人的聊天记录
+	var historyMessages []openai.ChatCompletionMessage
+	if groupId == nil {
+		historyMessages, err = s.historyService.GetRecentHistory(e.UserID, nil, 200) // 获取最近200条（100轮对话）
+	} else {
+		systemPrompt += fmt.Sprintf(groupChatNote, getUserName(e))
+		historyMessages, err = s.groupTranscript(e.GroupID)
+	}
 	if err != nil {
-		utils.Error("获取历史记录失败: %v", err)
+		log.Error("获取历史记录失败: %v", err)
 	}
 
 	// 构建完整的消息列表（系统提示 + 历史 + 当前消息）
@@ -157,24 +264,34 @@ func (s *MessageService) handleAIChat(event *protocol.Event, userMessage string)
 	messages = append(messages, historyMessages...)
 
 	// 调用AI服务
-	reply, err := s.aiService.ChatWithHistory(messages)
+	reply, err := s.aiService.ChatWithHistory(ctx, messages)
 	if err != nil {
-		utils.Error("AI服务错误: %v", err)
-		s.sendReply(event, "抱歉，AI服务暂时不可用")
-		return
+		if ctx.Err() != nil {
+			log.Debug("AI对话已取消: %v", ctx.Err())
+			return true
+		}
+		log.Error("AI服务错误: %v", err)
+		s.sendReply(ctx, e, "抱歉，AI服务暂时不可用")
+		return true
 	}
 
-	// 保存AI回复
-	err = s.historyService.SaveMessage(event.UserID, groupId, "assistant", reply)
+	// 保存AI回复（群聊中记为对该用户的回复）
+	if groupId == nil {
+		err = s.historyService.SaveMessage(e.UserID, nil, "assistant", reply)
+	} else {
+		err = s.historyService.SaveGroupMessage(e.GroupID, e.UserID, e.SelfID, "", "assistant", reply)
+	}
 	if err != nil {
-		utils.Error("保存AI回复失败: %v", err)
+		log.Error("保存AI回复失败: %v", err)
 	}
 
-	// 评估对话并更新关系
+	// 评估对话并更新关系（后台执行，程序关闭时取消）
+	evalCtx, cancel := event.Detach(ctx)
 	go func() {
-		evalResult, err := s.relationshipService.EvaluateAndUpdate(event.UserID, groupId, userMessage, reply)
+		defer cancel()
+		evalResult, err := s.relationshipService.EvaluateAndUpdate(evalCtx, e.UserID, groupId, userMessage, reply)
 		if err != nil {
-			utils.Error("关系评估失败: %v", err)
+			log.Error("关系评估失败: %v", err)
 			return
 		}
 
@@ -184,8 +301,8 @@ func (s *MessageService) handleAIChat(event *protocol.Event, userMessage string)
 			if evalResult.IsKeyMoment {
 				keyMark = " 🔥"
 			}
-			utils.Debug("关系评估 [QQ=%d]: 熟悉%.1f 信任%.1f 亲密%.1f%s - %s",
-				event.UserID,
+			log.Debug("关系评估 [QQ=%d]: 熟悉%.1f 信任%.1f 亲密%.1f%s - %s",
+				e.UserID,
 				evalResult.FamiliarityChange,
 				evalResult.TrustChange,
 				evalResult.IntimacyChange,
@@ -195,11 +312,12 @@ func (s *MessageService) handleAIChat(event *protocol.Event, userMessage string)
 	}()
 
 	// 发送回复
-	s.sendReply(event, reply)
+	s.sendReply(ctx, e, reply)
+	return true
 }
 
 // sendReply 发送回复（支持分段）
-func (s *MessageService) sendReply(event *protocol.Event, text string) {
+func (s *MessageService) sendReply(ctx context.Context, event *protocol.Event, text string) {
 	// 按 </> 分隔消息
 	parts := strings.Split(text, "</>")
 
@@ -217,33 +335,66 @@ func (s *MessageService) sendReply(event *protocol.Event, text string) {
 	}
 
 	// 发送第一条消息（立即发送）
-	s.sendSingleMessage(event, messages[0])
+	s.sendSingleMessage(ctx, event, messages[0])
 
-	// 发送后续消息（带延迟）
+	// 发送后续消息（带延迟，取消时放弃剩余分段）
 	for i := 1; i < len(messages); i++ {
 		delay := s.calculateDelay(messages[i])
-		time.Sleep(delay)
-		s.sendSingleMessage(event, messages[i])
+		s.showTyping(ctx, event)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			utils.Log(ctx).Debug("发送已取消，剩余%d条未发送", len(messages)-i)
+			return
+		}
+		s.sendSingleMessage(ctx, event, messages[i])
 	}
 }
 
-// sendSingleMessage 发送单条消息
-func (s *MessageService) sendSingleMessage(event *protocol.Event, text string) {
+// markRead 标记消息已读（需要NapCat扩展）
+func (s *MessageService) markRead(ctx context.Context, event *protocol.Event) {
 	var err error
-	var message interface{}
+	if event.MessageType == "private" {
+		err = s.api.MarkPrivateMessageAsRead(ctx, event.UserID)
+	} else if event.MessageType == "group" {
+		err = s.api.MarkGroupMessageAsRead(ctx, event.GroupID)
+	}
+
+	if err != nil && !errors.Is(err, protocol.ErrUnsupported) {
+		utils.Log(ctx).Debug("标记已读失败: %v", err)
+	}
+}
+
+// showTyping 私聊中显示"对方正在输入"（需要NapCat扩展）
+func (s *MessageService) showTyping(ctx context.Context, event *protocol.Event) {
+	if event.MessageType != "private" {
+		return
+	}
+
+	err := s.api.SetInputStatus(ctx, event.UserID, protocol.InputStatusTyping)
+	if err != nil && !errors.Is(err, protocol.ErrUnsupported) {
+		utils.Log(ctx).Debug("设置输入状态失败: %v", err)
+	}
+}
+
+// sendSingleMessage 发送单条消息（进入发件箱，按会话顺序限速发送）
+func (s *MessageService) sendSingleMessage(ctx context.Context, event *protocol.Event, text string) {
+	var targetID int64
 
 	// 根据消息格式构建消息
-	message = protocol.BuildArrayMessage(text)
+	message := protocol.BuildArrayMessage(text)
 
-	// 根据消息类型发送
+	// 根据消息类型确定发送目标
 	if event.MessageType == "private" {
-		err = s.api.SendPrivateMessage(event.UserID, message)
+		targetID = event.UserID
 	} else if event.MessageType == "group" {
-		err = s.api.SendGroupMessage(event.GroupID, message)
+		targetID = event.GroupID
+	} else {
+		return
 	}
 
-	if err != nil {
-		utils.Error("发送消息失败: %v", err)
+	if _, err := s.outbox.Enqueue(event.MessageType, targetID, message); err != nil {
+		utils.Log(ctx).Error("发送消息失败: %v", err)
 	}
 }
 
@@ -0,0 +1,346 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"qq_bot/config"
+	"qq_bot/connection"
+	"qq_bot/protocol"
+	"qq_bot/storage"
+	"qq_bot/utils"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 发件箱消息状态
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+// purgeInterval 清理过期发送记录的间隔
+const purgeInterval = time.Hour
+
+// Service 发件箱服务：消息先落库，再按会话顺序限速发送
+//
+// 投递语义为至少一次：API调用超时或连接中断时无法确认NapCat是否已发出，
+// 消息会保持pending并重试，因此极少数情况下同一条消息可能被发送两次
+type Service struct {
+	db       *gorm.DB
+	api      *protocol.API
+	selfID   int64
+	config   *config.OutboxConfig
+	global   *limiter
+	mu       sync.Mutex
+	workers  map[string]bool // 正在运行的会话worker
+	signals  map[string]bool // worker运行期间新入队的通知
+	readyCh  chan struct{}   // 连接可用时关闭
+	ready    bool
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService 创建发件箱服务
+func NewService(selfID int64, api *protocol.API, cfg *config.OutboxConfig) *Service {
+	if cfg == nil {
+		cfg = config.GetDefault().Outbox
+	}
+	return &Service{
+		db:       storage.GetDB(),
+		api:      api,
+		selfID:   selfID,
+		config:   cfg,
+		global:   newLimiter(time.Duration(cfg.GlobalInterval) * time.Millisecond),
+		workers:  make(map[string]bool),
+		signals:  make(map[string]bool),
+		readyCh:  make(chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 恢复数据库中未发送的消息，并定期清理过期的发送记录
+func (s *Service) Start() error {
+	var targets []storage.OutboxMessage
+	err := s.db.Model(&storage.OutboxMessage{}).
+		Select("DISTINCT target_type, target_id").
+		Where("self_id = ? AND status = ?", s.selfID, StatusPending).
+		Find(&targets).Error
+	if err != nil {
+		return fmt.Errorf("加载待发送消息失败: %v", err)
+	}
+
+	for _, t := range targets {
+		s.notify(t.TargetType, t.TargetId)
+	}
+	if len(targets) > 0 {
+		utils.Info("发件箱恢复 %d 个会话的待发送消息", len(targets))
+	}
+
+	go s.runPurge()
+	return nil
+}
+
+// Purge 删除早于保留时间的已发送/已放弃消息，返回删除条数
+func (s *Service) Purge(retention time.Duration) (int64, error) {
+	result := s.db.Where("self_id = ? AND status IN ? AND updated_at < ?",
+		s.selfID, []string{StatusSent, StatusFailed}, time.Now().Add(-retention)).
+		Delete(&storage.OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// runPurge 定期清理过期的发送记录，直到发件箱停止
+func (s *Service) runPurge() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.Purge(s.config.GetRetention())
+		if err != nil {
+			utils.Error("清理发件箱失败: %v", err)
+		} else if count > 0 {
+			utils.Info("已清理%d条过期的发件箱记录", count)
+		}
+
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop 停止发送
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+}
+
+// Idle 检查是否没有正在发送的会话
+func (s *Service) Idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.workers) == 0
+}
+
+// HandleStateChange 连接状态变更（订阅 connection.StateListener）
+func (s *Service) HandleStateChange(oldState, newState connection.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if newState == connection.StateConnected {
+		if !s.ready {
+			s.ready = true
+			close(s.readyCh)
+		}
+		return
+	}
+
+	if s.ready {
+		s.ready = false
+		s.readyCh = make(chan struct{})
+	}
+}
+
+// Enqueue 消息入队，返回发件箱记录ID
+func (s *Service) Enqueue(targetType string, targetID int64, message interface{}) (uint, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("marshal message error: %v", err)
+	}
+
+	msg := storage.OutboxMessage{
+		SelfId:     s.selfID,
+		TargetType: targetType,
+		TargetId:   targetID,
+		Message:    string(data),
+		Status:     StatusPending,
+	}
+	if err := s.db.Create(&msg).Error; err != nil {
+		return 0, fmt.Errorf("消息入队失败: %v", err)
+	}
+
+	s.notify(targetType, targetID)
+	return msg.ID, nil
+}
+
+// IsSentMessage 判断message_id是否为本账号经发件箱发出的消息
+func (s *Service) IsSentMessage(targetType string, targetID int64, messageID int32) (bool, error) {
+	var count int64
+	err := s.db.Model(&storage.OutboxMessage{}).
+		Where("self_id = ? AND target_type = ? AND target_id = ? AND message_id = ? AND status = ?",
+			s.selfID, targetType, targetID, messageID, StatusSent).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// notify 通知会话worker有新消息，必要时启动worker
+func (s *Service) notify(targetType string, targetID int64) {
+	key := fmt.Sprintf("%s:%d", targetType, targetID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.workers[key] {
+		s.signals[key] = true
+		return
+	}
+	s.workers[key] = true
+	go s.runWorker(key, targetType, targetID)
+}
+
+// runWorker 按入队顺序发送某个会话的消息
+func (s *Service) runWorker(key, targetType string, targetID int64) {
+	var lastSent time.Time
+	targetInterval := time.Duration(s.config.TargetInterval) * time.Millisecond
+
+	for {
+		s.mu.Lock()
+		delete(s.signals, key)
+		s.mu.Unlock()
+
+		var msg storage.OutboxMessage
+		err := s.db.Where("self_id = ? AND target_type = ? AND target_id = ? AND status = ?",
+			s.selfID, targetType, targetID, StatusPending).
+			Order("id").First(&msg).Error
+
+		if err == gorm.ErrRecordNotFound {
+			s.mu.Lock()
+			if !s.signals[key] {
+				delete(s.workers, key)
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			utils.Error("读取发件箱失败: %v", err)
+			if !s.sleep(time.Duration(s.config.RetryInterval) * time.Millisecond) {
+				return
+			}
+			continue
+		}
+
+		// 等待连接可用
+		if !s.waitReady() {
+			return
+		}
+
+		// 单会话限速 + 全局限速
+		if wait := targetInterval - time.Since(lastSent); wait > 0 {
+			if !s.sleep(wait) {
+				return
+			}
+		}
+		if !s.sleep(s.global.reserve()) {
+			return
+		}
+
+		if s.deliver(&msg) {
+			lastSent = time.Now()
+			continue
+		}
+
+		// 失败后按尝试次数递增等待，保持会话内顺序
+		if msg.Status == StatusPending {
+			if !s.sleep(time.Duration(msg.Attempts*s.config.RetryInterval) * time.Millisecond) {
+				return
+			}
+		}
+	}
+}
+
+// deliver 发送一条消息并更新状态，返回是否成功
+func (s *Service) deliver(msg *storage.OutboxMessage) bool {
+	message := protocol.ParseMessage(json.RawMessage(msg.Message))
+	result, err := s.api.SendMessage(context.Background(), msg.TargetType, msg.TargetId, message)
+	msg.Attempts++
+
+	if err != nil {
+		msg.LastError = err.Error()
+		if msg.Attempts >= s.config.MaxAttempts {
+			msg.Status = StatusFailed
+			utils.Error("消息发送失败，已放弃: id=%d, target=%s:%d, err=%v", msg.ID, msg.TargetType, msg.TargetId, err)
+		} else {
+			utils.Error("消息发送失败，稍后重试(%d/%d): id=%d, err=%v", msg.Attempts, s.config.MaxAttempts, msg.ID, err)
+		}
+	} else {
+		now := time.Now()
+		msg.Status = StatusSent
+		msg.SentAt = &now
+		msg.LastError = ""
+		if result != nil {
+			msg.MessageId = result.MessageID
+		}
+		utils.Debug("消息已发送: id=%d, message_id=%d", msg.ID, msg.MessageId)
+	}
+
+	if saveErr := s.db.Save(msg).Error; saveErr != nil {
+		utils.Error("更新发件箱状态失败: %v", saveErr)
+	}
+	return err == nil
+}
+
+// waitReady 等待连接可用，返回false表示已停止
+func (s *Service) waitReady() bool {
+	s.mu.Lock()
+	ch := s.readyCh
+	s.mu.Unlock()
+
+	select {
+	case <-ch:
+		return true
+	case <-s.stopChan:
+		return false
+	}
+}
+
+// sleep 可中断的等待，返回false表示已停止
+func (s *Service) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopChan:
+		return false
+	}
+}
+
+// limiter 最小间隔限速器
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newLimiter 创建限速器
+func newLimiter(interval time.Duration) *limiter {
+	return &limiter{interval: interval}
+}
+
+// reserve 预约下一个发送时间，返回需要等待的时长
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"path/filepath"
+	"qq_bot/storage"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+)
+
+func TestPurge(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	if err := storage.Open(sqlite.Open(dsn)); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	s := NewService(10001, nil, nil)
+
+	old := time.Now().Add(-8 * 24 * time.Hour)
+	rows := []storage.OutboxMessage{
+		{SelfId: 10001, TargetType: "private", TargetId: 1, Message: "[]", Status: StatusSent, UpdatedAt: old},
+		{SelfId: 10001, TargetType: "private", TargetId: 1, Message: "[]", Status: StatusFailed, UpdatedAt: old},
+		{SelfId: 10001, TargetType: "private", TargetId: 1, Message: "[]", Status: StatusPending, UpdatedAt: old}, // 未发送的不清理
+		{SelfId: 10001, TargetType: "private", TargetId: 1, Message: "[]", Status: StatusSent},                    // 未过期
+		{SelfId: 10002, TargetType: "private", TargetId: 1, Message: "[]", Status: StatusSent, UpdatedAt: old},    // 其他账号
+	}
+	if err := storage.GetDB().Create(&rows).Error; err != nil {
+		t.Fatalf("写入发件箱失败: %v", err)
+	}
+
+	count, err := s.Purge(7 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("清理 %d 条, 期望 2 条", count)
+	}
+
+	var remaining []uint
+	storage.GetDB().Model(&storage.OutboxMessage{}).Order("id").Pluck("id", &remaining)
+	if len(remaining) != 3 || remaining[0] != rows[2].ID || remaining[1] != rows[3].ID || remaining[2] != rows[4].ID {
+		t.Fatalf("剩余记录 %v, 期望 %d %d %d", remaining, rows[2].ID, rows[3].ID, rows[4].ID)
+	}
+}
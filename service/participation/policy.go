@@ -0,0 +1,148 @@
+package participation
+
+import (
+	"context"
+	"math/rand"
+	"qq_bot/config"
+	"qq_bot/event"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 参与模式
+const (
+	ModeAll   = "all"   // 回复所有消息
+	ModeSmart = "smart" // 按@、关键词、回复和兴趣参与
+)
+
+// SentChecker 判断消息是否为机器人发出（通常为 outbox.Service）
+type SentChecker interface {
+	IsSentMessage(targetType string, targetID int64, messageID int32) (bool, error)
+}
+
+// Policy 群聊参与策略：决定群消息是否进入AI对话
+type Policy struct {
+	config     *config.GroupChatConfig
+	sent       SentChecker
+	cooldown   time.Duration
+	mu         sync.Mutex
+	lastActive map[int64]time.Time // 群号 -> 上次主动参与时间
+	random     func() float64
+	now        func() time.Time
+}
+
+// NewPolicy 创建群聊参与策略
+func NewPolicy(cfg *config.GroupChatConfig, sent SentChecker) *Policy {
+	if cfg == nil {
+		cfg = config.GetDefault().GroupChat
+	}
+	return &Policy{
+		config:     cfg,
+		sent:       sent,
+		cooldown:   time.Duration(cfg.Cooldown) * time.Second,
+		lastActive: make(map[int64]time.Time),
+		random:     rand.Float64,
+		now:        time.Now,
+	}
+}
+
+// Register 注册群聊参与规则（在插件之后、AI对话之前执行，不参与时停止传播）
+func (p *Policy) Register(d *event.Dispatcher) {
+	d.Handle(event.Group(), p.filter).Priority(500).Name("群聊参与策略")
+}
+
+// filter 不参与时返回true停止传播
+func (p *Policy) filter(ctx context.Context, e *protocol.Event) bool {
+	join, reason := p.ShouldReply(e)
+	if join {
+		utils.Log(ctx).Debug("参与群 %d 的对话: %s", e.GroupID, reason)
+	}
+	return !join
+}
+
+// ShouldReply 判断是否回复该群消息，返回是否参与和原因
+func (p *Policy) ShouldReply(e *protocol.Event) (bool, string) {
+	if p.config.Mode == ModeAll {
+		return true, "回复所有消息"
+	}
+
+	chain := e.Segments()
+	if chain.Mentions(e.SelfID) {
+		return true, "被@"
+	}
+	if p.config.ReplyToBot && p.isReplyToBot(e, chain) {
+		return true, "回复机器人的消息"
+	}
+
+	// 以下为主动参与，受冷却时间限制
+	if p.coolingDown(e.GroupID) {
+		return false, ""
+	}
+
+	text := chain.PlainText()
+	for _, keyword := range p.config.Keywords {
+		if keyword != "" && strings.Contains(text, keyword) {
+			p.markActive(e.GroupID)
+			return true, "提到关键词 " + keyword
+		}
+	}
+
+	if p.random() < interestScore(text, p.config.InterestProbability) {
+		p.markActive(e.GroupID)
+		return true, "感兴趣"
+	}
+	return false, ""
+}
+
+// isReplyToBot 判断是否回复了机器人发出的消息
+func (p *Policy) isReplyToBot(e *protocol.Event, chain protocol.MessageChain) bool {
+	replyID, ok := chain.ReplyID()
+	if !ok {
+		return false
+	}
+
+	sent, err := p.sent.IsSentMessage("group", e.GroupID, replyID)
+	if err != nil {
+		utils.Error("查询回复的消息失败: %v", err)
+		return false
+	}
+	return sent
+}
+
+// coolingDown 群是否处于主动参与冷却中
+func (p *Policy) coolingDown(groupID int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	last, ok := p.lastActive[groupID]
+	return ok && p.now().Sub(last) < p.cooldown
+}
+
+// markActive 记录主动参与时间
+func (p *Policy) markActive(groupID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastActive[groupID] = p.now()
+}
+
+// interestScore 兴趣分数：以基础概率为准，提问加倍，过短的消息（嗯、表情等）减半
+func interestScore(text string, base float64) float64 {
+	text = strings.TrimSpace(text)
+	if text == "" || base <= 0 {
+		return 0
+	}
+
+	score := base
+	if strings.ContainsAny(text, "?？") {
+		score *= 2
+	}
+	if len([]rune(text)) < 4 {
+		score /= 2
+	}
+	if score > 1 {
+		score = 1
+	}
+	return score
+}
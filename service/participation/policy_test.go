@@ -0,0 +1,154 @@
+package participation
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"testing"
+	"time"
+)
+
+// stubSent 假发件箱：sent中的message_id视为机器人发出的消息
+type stubSent struct {
+	sent map[int32]bool
+	err  error
+}
+
+func (s stubSent) IsSentMessage(targetType string, targetID int64, messageID int32) (bool, error) {
+	return s.sent[messageID], s.err
+}
+
+// groupMessage 构建群888中用户123456发给机器人10001的消息事件
+func groupMessage(chain protocol.MessageChain) *protocol.Event {
+	message, _ := json.Marshal(chain)
+	return &protocol.Event{
+		SelfID:      10001,
+		PostType:    "message",
+		MessageType: "group",
+		GroupID:     888,
+		UserID:      123456,
+		Message:     message,
+	}
+}
+
+// newTestPolicy 创建smart模式策略，随机数固定为roll，时间由clock控制
+func newTestPolicy(sent SentChecker, roll float64, clock *time.Time) *Policy {
+	p := NewPolicy(&config.GroupChatConfig{
+		Mode:                ModeSmart,
+		Keywords:            []string{"小雪"},
+		ReplyToBot:          true,
+		InterestProbability: 0.1,
+		Cooldown:            60,
+	}, sent)
+	p.random = func() float64 { return roll }
+	p.now = func() time.Time { return *clock }
+	return p
+}
+
+func TestShouldReply(t *testing.T) {
+	sent := stubSent{sent: map[int32]bool{42: true}}
+
+	tests := []struct {
+		name   string
+		sent   SentChecker
+		roll   float64
+		chain  protocol.MessageChain
+		join   bool
+		reason string
+	}{
+		{"被@", sent, 1, protocol.NewMessage().At(10001).Text(" 在吗").Build(), true, "被@"},
+		{"@其他人不算", sent, 1, protocol.NewMessage().At(10002).Text(" 在吗").Build(), false, ""},
+		{"回复机器人的消息", sent, 1, protocol.NewMessage().Reply(42).Text("真的吗").Build(), true, "回复机器人的消息"},
+		{"回复其他人的消息", sent, 1, protocol.NewMessage().Reply(7).Text("真的吗").Build(), false, ""},
+		{"查询发件箱失败时不当作回复机器人", stubSent{err: errors.New("数据库错误")}, 1, protocol.NewMessage().Reply(42).Text("真的吗").Build(), false, ""},
+		{"提到关键词", sent, 1, protocol.NewMessage().Text("小雪今天去哪了").Build(), true, "提到关键词 小雪"},
+		{"随机数低于兴趣分数时参与", sent, 0.05, protocol.NewMessage().Text("今天天气不错").Build(), true, "感兴趣"},
+		{"随机数高于兴趣分数时不参与", sent, 0.15, protocol.NewMessage().Text("今天天气不错").Build(), false, ""},
+		{"提问时兴趣加倍", sent, 0.15, protocol.NewMessage().Text("今天天气怎么样？").Build(), true, "感兴趣"},
+		{"短消息兴趣减半", sent, 0.07, protocol.NewMessage().Text("嗯嗯").Build(), false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := time.Now()
+			p := newTestPolicy(tt.sent, tt.roll, &clock)
+			join, reason := p.ShouldReply(groupMessage(tt.chain))
+			if join != tt.join || reason != tt.reason {
+				t.Fatalf("ShouldReply = %v %q, 期望 %v %q", join, reason, tt.join, tt.reason)
+			}
+		})
+	}
+}
+
+func TestShouldReplyModeAll(t *testing.T) {
+	p := NewPolicy(&config.GroupChatConfig{Mode: ModeAll}, stubSent{})
+	if join, _ := p.ShouldReply(groupMessage(protocol.NewMessage().Text("嗯").Build())); !join {
+		t.Fatal("all模式应回复所有消息")
+	}
+}
+
+func TestShouldReplyCooldown(t *testing.T) {
+	clock := time.Now()
+	p := newTestPolicy(stubSent{sent: map[int32]bool{42: true}}, 0, &clock)
+	keyword := groupMessage(protocol.NewMessage().Text("小雪在吗").Build())
+
+	if join, _ := p.ShouldReply(keyword); !join {
+		t.Fatal("首次提到关键词应参与")
+	}
+
+	// 冷却期间关键词和兴趣都不参与，其他群不受影响
+	clock = clock.Add(30 * time.Second)
+	if join, _ := p.ShouldReply(keyword); join {
+		t.Fatal("冷却期间不应因关键词参与")
+	}
+	if join, _ := p.ShouldReply(groupMessage(protocol.NewMessage().Text("今天天气怎么样？").Build())); join {
+		t.Fatal("冷却期间不应因兴趣参与")
+	}
+	other := groupMessage(protocol.NewMessage().Text("小雪在吗").Build())
+	other.GroupID = 999
+	if join, _ := p.ShouldReply(other); !join {
+		t.Fatal("其他群不受冷却影响")
+	}
+
+	// 被@和回复机器人不受冷却限制，也不会延长冷却
+	if join, reason := p.ShouldReply(groupMessage(protocol.NewMessage().At(10001).Text(" 在吗").Build())); !join {
+		t.Fatalf("冷却期间被@应参与, 原因 %q", reason)
+	}
+	if join, _ := p.ShouldReply(groupMessage(protocol.NewMessage().Reply(42).Text("嗯").Build())); !join {
+		t.Fatal("冷却期间回复机器人应参与")
+	}
+
+	// 冷却结束后恢复
+	clock = clock.Add(31 * time.Second)
+	if join, _ := p.ShouldReply(keyword); !join {
+		t.Fatal("冷却结束后提到关键词应参与")
+	}
+}
+
+func TestInterestScore(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		base float64
+		want float64
+	}{
+		{"普通消息", "今天天气不错", 0.1, 0.1},
+		{"中文问号加倍", "今天天气怎么样？", 0.1, 0.2},
+		{"英文问号加倍", "what's up?", 0.1, 0.2},
+		{"短消息减半", "嗯嗯", 0.1, 0.05},
+		{"短提问加倍后减半", "好吗?", 0.1, 0.1},
+		{"首尾空白不计入长度", "  嗯  ", 0.1, 0.05},
+		{"空消息", "   ", 0.1, 0},
+		{"基础概率为0", "今天天气怎么样？", 0, 0},
+		{"不超过1", "今天天气怎么样？", 0.8, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interestScore(tt.text, tt.base); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("interestScore(%q, %v) = %v, 期望 %v", tt.text, tt.base, got, tt.want)
+			}
+		})
+	}
+}
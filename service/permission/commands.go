@@ -0,0 +1,198 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/command"
+	"qq_bot/protocol"
+	"qq_bot/utils"
+)
+
+// RegisterCommands 注册权限管理命令
+func (s *Service) RegisterCommands(r *command.Registry) {
+	r.MustRegister(&command.Command{
+		Name:        "role",
+		Description: "查看角色",
+		Args:        []command.Arg{{Name: "QQ", Type: command.ArgInt, Optional: true, Desc: "默认查看自己"}},
+		Handler:     s.handleRole,
+	})
+	r.MustRegister(&command.Command{
+		Name:        "grant",
+		Description: "授予角色",
+		Args: []command.Arg{
+			{Name: "QQ", Type: command.ArgInt},
+			{Name: "角色", Choices: []string{string(RoleAdmin), string(RoleTrusted), string(RoleUser), string(RoleBanned)}},
+			{Name: "群号", Type: command.ArgInt, Optional: true, Desc: "0表示全局；省略时群聊中作用于本群，私聊中为全局"},
+		},
+		Usage:   "只能授予低于自己的角色，也不能修改角色不低于自己的用户",
+		Level:   command.LevelAdmin,
+		Handler: s.handleGrant,
+	})
+	r.MustRegister(&command.Command{
+		Name:        "revoke",
+		Description: "撤销角色",
+		Args: []command.Arg{
+			{Name: "QQ", Type: command.ArgInt},
+			{Name: "群号", Type: command.ArgInt, Optional: true, Desc: "0表示全局；省略时群聊中作用于本群，私聊中为全局"},
+		},
+		Level:   command.LevelAdmin,
+		Handler: s.handleRevoke,
+	})
+	r.MustRegister(&command.Command{
+		Name:        "group",
+		Description: "设置群白名单/黑名单",
+		Args: []command.Arg{
+			{Name: "操作", Choices: []string{GroupAllow, GroupBlock, "reset"}},
+			{Name: "群号", Type: command.ArgInt, Optional: true, Desc: "省略时为当前群"},
+		},
+		Usage:   "allow 群成员均可使用，block 忽略群内所有消息，reset 恢复默认；需要全局管理员",
+		Level:   command.LevelAdmin,
+		Handler: s.handleGroup,
+	})
+}
+
+// handleRole 查看角色
+func (s *Service) handleRole(ctx context.Context, call *command.Call) error {
+	e := call.Event
+	qq := e.UserID
+	if call.Args.Has("QQ") {
+		qq = call.Args.Int("QQ")
+	}
+
+	role := s.RoleOf(qq, e.GroupID, senderRoleFor(e, qq))
+	text := fmt.Sprintf("QQ %d 当前角色: %s", qq, role)
+	if global, ok := s.ExplicitRole(qq, 0); ok {
+		text += fmt.Sprintf("\n全局授权: %s", global)
+	}
+	if e.GroupID != 0 {
+		if group, ok := s.ExplicitRole(qq, e.GroupID); ok {
+			text += fmt.Sprintf("\n本群授权: %s", group)
+		}
+	}
+	call.Reply(ctx, text)
+	return nil
+}
+
+// handleGrant 授予角色
+func (s *Service) handleGrant(ctx context.Context, call *command.Call) error {
+	e := call.Event
+	target := call.Args.Int("QQ")
+	role, _ := ParseRole(call.Args.String("角色"))
+	groupID := scopeGroup(e, call.Args)
+
+	if err := s.checkManage(e, target, groupID, role); err != nil {
+		call.Reply(ctx, err.Error())
+		return nil
+	}
+	if err := s.Grant(target, groupID, role, e.UserID); err != nil {
+		return err
+	}
+
+	utils.Log(ctx).Info("QQ=%d 授予 %d 角色 %s (%s)", e.UserID, target, role, scopeName(groupID))
+	call.Reply(ctx, fmt.Sprintf("已在%s授予 %d %s角色", scopeName(groupID), target, role))
+	return nil
+}
+
+// handleRevoke 撤销角色
+func (s *Service) handleRevoke(ctx context.Context, call *command.Call) error {
+	e := call.Event
+	target := call.Args.Int("QQ")
+	groupID := scopeGroup(e, call.Args)
+
+	if _, ok := s.ExplicitRole(target, groupID); !ok {
+		call.Reply(ctx, fmt.Sprintf("%d 在%s没有授权的角色", target, scopeName(groupID)))
+		return nil
+	}
+	if err := s.checkManage(e, target, groupID, RoleNone); err != nil {
+		call.Reply(ctx, err.Error())
+		return nil
+	}
+	if err := s.Revoke(target, groupID); err != nil {
+		return err
+	}
+
+	utils.Log(ctx).Info("QQ=%d 撤销 %d 的角色 (%s)", e.UserID, target, scopeName(groupID))
+	call.Reply(ctx, fmt.Sprintf("已撤销 %d 在%s的角色", target, scopeName(groupID)))
+	return nil
+}
+
+// handleGroup 设置群策略
+func (s *Service) handleGroup(ctx context.Context, call *command.Call) error {
+	e := call.Event
+	groupID := e.GroupID
+	if call.Args.Has("群号") {
+		groupID = call.Args.Int("群号")
+	}
+	if groupID <= 0 {
+		call.Reply(ctx, "请指定群号")
+		return nil
+	}
+	if s.RoleOf(e.UserID, 0, "").rank() < RoleAdmin.rank() {
+		call.Reply(ctx, "权限不足，需要全局管理员权限")
+		return nil
+	}
+
+	mode := call.Args.String("操作")
+	if mode == "reset" {
+		mode = ""
+	}
+	if err := s.SetGroupMode(groupID, mode); err != nil {
+		return err
+	}
+
+	utils.Log(ctx).Info("QQ=%d 设置群 %d 策略: %q", e.UserID, groupID, mode)
+	switch mode {
+	case GroupAllow:
+		call.Reply(ctx, fmt.Sprintf("已将群 %d 加入白名单", groupID))
+	case GroupBlock:
+		call.Reply(ctx, fmt.Sprintf("已将群 %d 加入黑名单", groupID))
+	default:
+		call.Reply(ctx, fmt.Sprintf("已恢复群 %d 的默认设置", groupID))
+	}
+	return nil
+}
+
+// checkManage 检查调用者能否在该范围内将目标设置为role（RoleNone表示撤销）
+// 调用者的角色必须高于目标当前角色和要授予的角色
+func (s *Service) checkManage(e *protocol.Event, target, groupID int64, role Role) error {
+	if target == e.UserID {
+		return fmt.Errorf("不能修改自己的角色")
+	}
+
+	senderRole := ""
+	if groupID == e.GroupID {
+		senderRole = senderRoleFor(e, e.UserID)
+	}
+	callerRank := s.RoleOf(e.UserID, groupID, senderRole).rank()
+	if callerRank <= role.rank() {
+		return fmt.Errorf("权限不足，不能授予%s角色", role)
+	}
+	if callerRank <= s.RoleOf(target, groupID, "").rank() {
+		return fmt.Errorf("权限不足，不能修改角色不低于自己的用户")
+	}
+	return nil
+}
+
+// scopeGroup 解析命令的作用范围：指定群号时使用群号（0为全局），否则群聊为本群、私聊为全局
+func scopeGroup(e *protocol.Event, args command.Args) int64 {
+	if args.Has("群号") {
+		return args.Int("群号")
+	}
+	return e.GroupID
+}
+
+// senderRoleFor 事件发送者的群内身份（仅当查询的是发送者本人时可用）
+func senderRoleFor(e *protocol.Event, qq int64) string {
+	if e.Sender == nil || e.UserID != qq {
+		return ""
+	}
+	return e.Sender.Role
+}
+
+// scopeName 范围名称
+func scopeName(groupID int64) string {
+	if groupID == 0 {
+		return "全局"
+	}
+	return fmt.Sprintf("群 %d ", groupID)
+}
@@ -0,0 +1,300 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"qq_bot/command"
+	"qq_bot/config"
+	"qq_bot/protocol"
+	"qq_bot/storage"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Role 角色
+type Role string
+
+const (
+	RoleNone    Role = ""        // 未授权
+	RoleBanned  Role = "banned"  // 封禁
+	RoleUser    Role = "user"    // 普通用户
+	RoleTrusted Role = "trusted" // 信任用户
+	RoleAdmin   Role = "admin"   // 管理员
+	RoleOwner   Role = "owner"   // 主人
+)
+
+// ParseRole 解析角色名
+func ParseRole(name string) (Role, bool) {
+	switch r := Role(name); r {
+	case RoleBanned, RoleUser, RoleTrusted, RoleAdmin, RoleOwner:
+		return r, true
+	}
+	return RoleNone, false
+}
+
+// rank 角色高低（用于授权比较）
+func (r Role) rank() int {
+	switch r {
+	case RoleUser:
+		return 1
+	case RoleTrusted:
+		return 2
+	case RoleAdmin:
+		return 3
+	case RoleOwner:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// Level 角色对应的命令权限等级
+func (r Role) Level() command.Level {
+	switch r {
+	case RoleOwner:
+		return command.LevelOwner
+	case RoleAdmin:
+		return command.LevelAdmin
+	case RoleTrusted:
+		return command.LevelTrusted
+	default:
+		return command.LevelUser
+	}
+}
+
+// String 角色名称
+func (r Role) String() string {
+	switch r {
+	case RoleBanned:
+		return "封禁"
+	case RoleUser:
+		return "普通用户"
+	case RoleTrusted:
+		return "信任用户"
+	case RoleAdmin:
+		return "管理员"
+	case RoleOwner:
+		return "主人"
+	default:
+		return "未授权"
+	}
+}
+
+// 群策略
+const (
+	GroupAllow = "allow" // 白名单群：群成员均可使用
+	GroupBlock = "block" // 黑名单群：忽略群内所有消息
+)
+
+// roleKey 角色缓存键（group为0表示全局）
+type roleKey struct {
+	qq    int64
+	group int64
+}
+
+// Service 权限服务（数据库持久化，内存缓存）
+type Service struct {
+	db             *gorm.DB
+	selfID         int64
+	owners         []int64 // 配置的主人
+	allowedQQs     []int64 // 配置的白名单（视为普通用户）
+	public         bool
+	groupAdminRole Role
+
+	mu     sync.RWMutex
+	roles  map[roleKey]Role
+	groups map[int64]string
+}
+
+// NewService 创建权限服务并加载该账号的角色和群策略
+func NewService(selfID int64, owners, allowedQQs []int64, cfg *config.PermissionConfig) (*Service, error) {
+	if cfg == nil {
+		cfg = config.GetDefault().Permission
+	}
+
+	groupAdminRole, _ := ParseRole(cfg.GroupAdminRole)
+	if groupAdminRole.rank() > RoleAdmin.rank() {
+		groupAdminRole = RoleAdmin
+	}
+
+	s := &Service{
+		db:             storage.GetDB(),
+		selfID:         selfID,
+		owners:         owners,
+		allowedQQs:     allowedQQs,
+		public:         cfg.Public,
+		groupAdminRole: groupAdminRole,
+		roles:          make(map[roleKey]Role),
+		groups:         make(map[int64]string),
+	}
+
+	var roles []storage.UserRole
+	if err := s.db.Where("self_id = ?", selfID).Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("加载用户角色失败: %v", err)
+	}
+	for _, r := range roles {
+		s.roles[roleKey{qq: r.QQId, group: r.GroupId}] = Role(r.Role)
+	}
+
+	var policies []storage.GroupPolicy
+	if err := s.db.Where("self_id = ?", selfID).Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("加载群策略失败: %v", err)
+	}
+	for _, p := range policies {
+		s.groups[p.GroupId] = p.Mode
+	}
+	return s, nil
+}
+
+// RoleOf 获取用户的有效角色
+// groupID为0表示全局；senderRole为群内身份（owner/admin/member），仅对groupID所在群有效
+func (s *Service) RoleOf(qq, groupID int64, senderRole string) Role {
+	if contains(s.owners, qq) {
+		return RoleOwner
+	}
+
+	s.mu.RLock()
+	groupRole, hasGroupRole := s.roles[roleKey{qq: qq, group: groupID}]
+	globalRole, hasGlobalRole := s.roles[roleKey{qq: qq}]
+	groupMode := s.groups[groupID]
+	s.mu.RUnlock()
+
+	// 显式授权：群内角色优先于全局角色
+	if groupID != 0 && hasGroupRole {
+		return groupRole
+	}
+	if hasGlobalRole {
+		return globalRole
+	}
+
+	groupAllowed := groupID != 0 && groupMode == GroupAllow
+	if groupAllowed && (senderRole == "owner" || senderRole == "admin") && s.groupAdminRole != RoleNone {
+		return s.groupAdminRole
+	}
+	if contains(s.allowedQQs, qq) || groupAllowed || s.public {
+		return RoleUser
+	}
+	return RoleNone
+}
+
+// EventRole 获取事件发送者在事件所在会话的角色
+func (s *Service) EventRole(e *protocol.Event) Role {
+	senderRole := ""
+	if e.Sender != nil {
+		senderRole = e.Sender.Role
+	}
+	return s.RoleOf(e.UserID, e.GroupID, senderRole)
+}
+
+// Allowed 判断事件发送者能否使用机器人（黑名单群、封禁和未授权用户返回false）
+func (s *Service) Allowed(e *protocol.Event) bool {
+	if e.GroupID != 0 && s.GroupMode(e.GroupID) == GroupBlock {
+		return false
+	}
+	role := s.EventRole(e)
+	return role != RoleNone && role != RoleBanned
+}
+
+// CommandLevel 命令权限等级（用于 command.Registry.SetPermission）
+func (s *Service) CommandLevel(ctx context.Context, e *protocol.Event) command.Level {
+	return s.EventRole(e).Level()
+}
+
+// ScopeLevel 事件发送者在指定范围（群号，0为全局）内的命令权限等级（用于 plugin.Manager.SetPermission）
+func (s *Service) ScopeLevel(e *protocol.Event, groupID int64) command.Level {
+	senderRole := ""
+	if groupID == e.GroupID {
+		senderRole = senderRoleFor(e, e.UserID)
+	}
+	return s.RoleOf(e.UserID, groupID, senderRole).Level()
+}
+
+// ExplicitRole 获取显式授权的角色（不含配置和群身份推导）
+func (s *Service) ExplicitRole(qq, groupID int64) (Role, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.roles[roleKey{qq: qq, group: groupID}]
+	return role, ok
+}
+
+// Grant 授予角色（groupID为0表示全局）
+func (s *Service) Grant(qq, groupID int64, role Role, grantedBy int64) error {
+	row := storage.UserRole{
+		SelfId:    s.selfID,
+		QQId:      qq,
+		GroupId:   groupID,
+		Role:      string(role),
+		GrantedBy: grantedBy,
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "self_id"}, {Name: "qq_id"}, {Name: "group_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("保存角色失败: %v", err)
+	}
+
+	s.mu.Lock()
+	s.roles[roleKey{qq: qq, group: groupID}] = role
+	s.mu.Unlock()
+	return nil
+}
+
+// Revoke 撤销显式授权的角色
+func (s *Service) Revoke(qq, groupID int64) error {
+	err := s.db.Where("self_id = ? AND qq_id = ? AND group_id = ?", s.selfID, qq, groupID).
+		Delete(&storage.UserRole{}).Error
+	if err != nil {
+		return fmt.Errorf("删除角色失败: %v", err)
+	}
+
+	s.mu.Lock()
+	delete(s.roles, roleKey{qq: qq, group: groupID})
+	s.mu.Unlock()
+	return nil
+}
+
+// GroupMode 获取群策略（allow/block，未设置为空）
+func (s *Service) GroupMode(groupID int64) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups[groupID]
+}
+
+// SetGroupMode 设置群策略，mode为空时删除
+func (s *Service) SetGroupMode(groupID int64, mode string) error {
+	var err error
+	if mode == "" {
+		err = s.db.Where("self_id = ? AND group_id = ?", s.selfID, groupID).Delete(&storage.GroupPolicy{}).Error
+	} else {
+		row := storage.GroupPolicy{SelfId: s.selfID, GroupId: groupID, Mode: mode}
+		err = s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "self_id"}, {Name: "group_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"mode", "updated_at"}),
+		}).Create(&row).Error
+	}
+	if err != nil {
+		return fmt.Errorf("保存群策略失败: %v", err)
+	}
+
+	s.mu.Lock()
+	if mode == "" {
+		delete(s.groups, groupID)
+	} else {
+		s.groups[groupID] = mode
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// contains 检查ID列表
+func contains(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"qq_bot/storage"
 	"qq_bot/utils"
 	"strings"
@@ -27,23 +28,25 @@ type EvaluationResult struct {
 type Evaluator struct {
 	client     *openai.Client
 	db         *gorm.DB
+	selfID     int64 // 所属机器人QQ号
 	basePrompt string
 	userLocks  sync.Map // map[int64]*sync.Mutex 每个用户的专属锁
 }
 
 // NewEvaluator 创建评估器
-func NewEvaluator(client *openai.Client, db *gorm.DB) *Evaluator {
-	prompt := loadEvaluatorPrompt()
+func NewEvaluator(client *openai.Client, db *gorm.DB, selfID int64, promptDir string) *Evaluator {
+	prompt := loadEvaluatorPrompt(promptDir)
 	return &Evaluator{
 		client:     client,
 		db:         db,
+		selfID:     selfID,
 		basePrompt: prompt,
 	}
 }
 
 // loadEvaluatorPrompt 加载评估器提示词
-func loadEvaluatorPrompt() string {
-	data, err := os.ReadFile("system_prompts/evaluator.txt")
+func loadEvaluatorPrompt(promptDir string) string {
+	data, err := os.ReadFile(filepath.Join(promptDir, "evaluator.txt"))
 	if err != nil {
 		utils.Error("加载evaluator.txt失败: %v，使用默认提示词", err)
 		return "你是人际关系专家，基于生物学和心理学原理评估对话。"
@@ -55,17 +58,11 @@ func loadEvaluatorPrompt() string {
 func (e *Evaluator) GetOrCreateRelationship(qqId int64, groupId *int64) (*storage.UserRelationship, error) {
 	var rel storage.UserRelationship
 
-	query := e.db.Where("qq_id = ?", qqId)
-	if groupId != nil {
-		query = query.Where("group_id = ?", *groupId)
-	} else {
-		query = query.Where("group_id IS NULL")
-	}
-
-	err := query.First(&rel).Error
+	err := e.scope(qqId, groupId).First(&rel).Error
 	if err == gorm.ErrRecordNotFound {
 		// 创建新记录
 		rel = storage.UserRelationship{
+			SelfId:              e.selfID,
 			QQId:                qqId,
 			GroupId:             groupId,
 			Stage:               1,
@@ -86,6 +83,15 @@ func (e *Evaluator) GetOrCreateRelationship(qqId int64, groupId *int64) (*storag
 	return &rel, nil
 }
 
+// scope 限定到用户在某个会话的关系（groupId为nil表示私聊）
+func (e *Evaluator) scope(qqId int64, groupId *int64) *gorm.DB {
+	query := e.db.Where("self_id = ? AND qq_id = ?", e.selfID, qqId)
+	if groupId != nil {
+		return query.Where("group_id = ?", *groupId)
+	}
+	return query.Where("group_id IS NULL")
+}
+
 // GetUserLock 获取用户专属锁（避免同一用户并发评估）
 func (e *Evaluator) GetUserLock(qqId int64) *sync.Mutex {
 	lock, _ := e.userLocks.LoadOrStore(qqId, &sync.Mutex{})
@@ -93,13 +99,14 @@ func (e *Evaluator) GetUserLock(qqId int64) *sync.Mutex {
 }
 
 // Evaluate 评估对话并更新关系
-func (e *Evaluator) Evaluate(qqId int64, groupId *int64, userMsg, aiMsg string, recentHistory []storage.ChatHistory) (*EvaluationResult, error) {
+func (e *Evaluator) Evaluate(ctx context.Context, qqId int64, groupId *int64, userMsg, aiMsg string, recentHistory []storage.ChatHistory) (*EvaluationResult, error) {
 	// 获取用户专属锁，确保同一用户的评估串行执行
 	lock := e.GetUserLock(qqId)
 	lock.Lock()
 	defer lock.Unlock()
 
-	utils.Debug("[评估锁] QQ=%d 获取锁成功，开始评估", qqId)
+	log := utils.Log(ctx)
+	log.Debug("[评估锁] QQ=%d 获取锁成功，开始评估", qqId)
 
 	// 获取当前关系状态
 	rel, err := e.GetOrCreateRelationship(qqId, groupId)
@@ -116,7 +123,7 @@ func (e *Evaluator) Evaluate(qqId int64, groupId *int64, userMsg, aiMsg string,
 
 	if !shouldEvaluate {
 		// 未达到阈值，只更新计数，不真正评估
-		utils.Debug("[评估跳过] QQ=%d 累计%d/%d次，跳过AI评估",
+		log.Debug("[评估跳过] QQ=%d 累计%d/%d次，跳过AI评估",
 			qqId, rel.AccumulatedCount, rel.EvaluationThreshold)
 
 		if err := e.db.Save(rel).Error; err != nil {
@@ -134,15 +141,19 @@ func (e *Evaluator) Evaluate(qqId int64, groupId *int64, userMsg, aiMsg string,
 	}
 
 	// 达到阈值，执行真正的AI评估
-	utils.Debug("[AI评估] QQ=%d 达到阈值，开始AI评估", qqId)
+	log.Debug("[AI评估] QQ=%d 达到阈值，开始AI评估", qqId)
 
 	// 构建评估prompt
 	prompt := e.buildEvaluationPrompt(rel, recentHistory, userMsg, aiMsg)
 
 	// 调用AI评估
-	result, err := e.callAIEvaluator(prompt)
+	result, err := e.callAIEvaluator(ctx, prompt)
 	if err != nil {
-		utils.Error("AI评估失败: %v，使用默认值", err)
+		// 已取消（程序关闭）时不再降级评估
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("评估已取消: %v", ctx.Err())
+		}
+		log.Error("AI评估失败: %v，使用默认值", err)
 		// 降级到简单规则
 		result = e.fallbackEvaluation(userMsg, aiMsg)
 	}
@@ -216,9 +227,9 @@ func (e *Evaluator) buildEvaluationPrompt(rel *storage.UserRelationship, history
 }
 
 // callAIEvaluator 调用AI评估器
-func (e *Evaluator) callAIEvaluator(prompt string) (*EvaluationResult, error) {
+func (e *Evaluator) callAIEvaluator(ctx context.Context, prompt string) (*EvaluationResult, error) {
 	resp, err := e.client.CreateChatCompletion(
-		context.Background(),
+		ctx,
 		openai.ChatCompletionRequest{
 			Model: "deepseek-chat", // 使用DeepSeek模型
 			Messages: []openai.ChatCompletionMessage{
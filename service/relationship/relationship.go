@@ -1,8 +1,10 @@
 package relationship
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"qq_bot/storage"
 	"qq_bot/utils"
 
@@ -14,24 +16,32 @@ import (
 type Service struct {
 	evaluator *Evaluator
 	db        *gorm.DB
+	selfID    int64  // 所属机器人QQ号
+	promptDir string // 人设提示词目录
 }
 
 // NewService 创建关系服务
-func NewService(client *openai.Client, db *gorm.DB) *Service {
+func NewService(client *openai.Client, db *gorm.DB, selfID int64, promptDir string) *Service {
 	return &Service{
-		evaluator: NewEvaluator(client, db),
+		evaluator: NewEvaluator(client, db, selfID, promptDir),
 		db:        db,
+		selfID:    selfID,
+		promptDir: promptDir,
 	}
 }
 
 // GetStagePrompt 获取当前阶段的系统提示词
-func (s *Service) GetStagePrompt(qqId int64, groupId *int64) (string, error) {
+func (s *Service) GetStagePrompt(ctx context.Context, qqId int64, groupId *int64) (string, error) {
 	// 🔥 关键优化：等待该用户的评估完成（如果有正在进行的）
 	lock := s.evaluator.GetUserLock(qqId)
 	lock.Lock()
 	lock.Unlock() // 立即释放，只是为了等待
 
-	utils.Debug("[等待机制] QQ=%d 等待评估完成，获取最新关系状态", qqId)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	utils.Log(ctx).Debug("[等待机制] QQ=%d 等待评估完成，获取最新关系状态", qqId)
 
 	// 重新获取关系状态（确保是最新的）
 	rel, err := s.evaluator.GetOrCreateRelationship(qqId, groupId)
@@ -40,7 +50,7 @@ func (s *Service) GetStagePrompt(qqId int64, groupId *int64) (string, error) {
 	}
 
 	// 加载基础提示词
-	basePrompt, err := loadBasePrompt()
+	basePrompt, err := s.loadBasePrompt()
 	if err != nil {
 		return "", err
 	}
@@ -74,7 +84,7 @@ func (s *Service) loadStagePromptFile(stage int) (string, error) {
 		return "", fmt.Errorf("无效的阶段: %d", stage)
 	}
 
-	filename := fmt.Sprintf("system_prompts/stage_%d_%s.txt", stage, stageName)
+	filename := filepath.Join(s.promptDir, fmt.Sprintf("stage_%d_%s.txt", stage, stageName))
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return "", fmt.Errorf("读取阶段提示词失败: %v", err)
@@ -93,16 +103,16 @@ func (s *Service) injectScores(prompt string, rel *storage.UserRelationship) str
 }
 
 // EvaluateAndUpdate 评估对话并更新关系
-func (s *Service) EvaluateAndUpdate(qqId int64, groupId *int64, userMsg, aiMsg string) (*EvaluationResult, error) {
+func (s *Service) EvaluateAndUpdate(ctx context.Context, qqId int64, groupId *int64, userMsg, aiMsg string) (*EvaluationResult, error) {
 	// 获取最近5轮历史
 	history, err := s.getRecentHistory(qqId, groupId, 10) // 10条记录=5轮对话
 	if err != nil {
-		utils.Error("获取历史记录失败: %v", err)
+		utils.Log(ctx).Error("获取历史记录失败: %v", err)
 		history = []storage.ChatHistory{} // 继续执行，使用空历史
 	}
 
 	// 调用评估器
-	result, err := s.evaluator.Evaluate(qqId, groupId, userMsg, aiMsg, history)
+	result, err := s.evaluator.Evaluate(ctx, qqId, groupId, userMsg, aiMsg, history)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +124,7 @@ func (s *Service) EvaluateAndUpdate(qqId int64, groupId *int64, userMsg, aiMsg s
 func (s *Service) getRecentHistory(qqId int64, groupId *int64, limit int) ([]storage.ChatHistory, error) {
 	var history []storage.ChatHistory
 
-	query := s.db.Where("qq_id = ?", qqId)
+	query := s.db.Where("self_id = ? AND qq_id = ?", s.selfID, qqId)
 	if groupId != nil {
 		query = query.Where("group_id = ?", *groupId)
 	} else {
@@ -135,14 +145,24 @@ func (s *Service) getRecentHistory(qqId int64, groupId *int64, limit int) ([]sto
 	return history, nil
 }
 
+// ResetRelationship 重置用户在某个会话的关系（groupId为nil表示私聊，删除后下次对话从陌生阶段重新开始）
+func (s *Service) ResetRelationship(qqId int64, groupId *int64) error {
+	// 等待进行中的评估完成，避免评估结果写回已重置的关系
+	lock := s.evaluator.GetUserLock(qqId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	return s.evaluator.scope(qqId, groupId).Delete(&storage.UserRelationship{}).Error
+}
+
 // GetRelationshipStatus 获取关系状态
 func (s *Service) GetRelationshipStatus(qqId int64, groupId *int64) (*storage.UserRelationship, error) {
 	return s.evaluator.GetOrCreateRelationship(qqId, groupId)
 }
 
 // loadBasePrompt 加载基础提示词
-func loadBasePrompt() (string, error) {
-	data, err := os.ReadFile("system_prompts/base.txt")
+func (s *Service) loadBasePrompt() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.promptDir, "base.txt"))
 	if err != nil {
 		return "", fmt.Errorf("读取base.txt失败: %v", err)
 	}
@@ -0,0 +1,97 @@
+package relationship
+
+import (
+	"context"
+	"path/filepath"
+	"qq_bot/storage"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+)
+
+// openTestDB 打开临时SQLite数据库并迁移表结构
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	if err := storage.Open(sqlite.Open(dsn)); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+}
+
+func TestRelationshipPrivateThenGroup(t *testing.T) {
+	openTestDB(t)
+	s := NewService(nil, storage.GetDB(), 10001, "../../system_prompts")
+	ctx := context.Background()
+	group := int64(888)
+
+	// 同一用户先私聊再在群里聊天，私聊和群各有一条关系
+	private, err := s.GetRelationshipStatus(123456, nil)
+	if err != nil {
+		t.Fatalf("创建私聊关系失败: %v", err)
+	}
+	inGroup, err := s.GetRelationshipStatus(123456, &group)
+	if err != nil {
+		t.Fatalf("已有私聊关系时创建群关系失败: %v", err)
+	}
+	if private.ID == inGroup.ID || inGroup.GroupId == nil || *inGroup.GroupId != group {
+		t.Fatalf("群关系 = %+v, 期望与私聊关系 %d 分开的新记录", inGroup, private.ID)
+	}
+
+	prompt, err := s.GetStagePrompt(ctx, 123456, &group)
+	if err != nil {
+		t.Fatalf("获取群聊人设失败: %v", err)
+	}
+	if !strings.Contains(prompt, "当前分数") {
+		t.Fatalf("群聊人设 = %q, 期望包含阶段提示词", prompt)
+	}
+
+	// 再次获取返回已有记录，不会重复创建
+	again, err := s.GetRelationshipStatus(123456, &group)
+	if err != nil || again.ID != inGroup.ID {
+		t.Fatalf("再次获取群关系 = %+v, %v, 期望记录 %d", again, err, inGroup.ID)
+	}
+	var count int64
+	storage.GetDB().Model(&storage.UserRelationship{}).Where("self_id = ? AND qq_id = ?", 10001, 123456).Count(&count)
+	if count != 2 {
+		t.Fatalf("关系记录 %d 条, 期望 2 条", count)
+	}
+
+	// 私聊关系仍然唯一
+	if err := storage.GetDB().Create(&storage.UserRelationship{SelfId: 10001, QQId: 123456}).Error; err == nil {
+		t.Fatal("重复的私聊关系应违反唯一索引")
+	}
+}
+
+func TestResetRelationshipScope(t *testing.T) {
+	openTestDB(t)
+	s := NewService(nil, storage.GetDB(), 10001, "../../system_prompts")
+	group, other := int64(888), int64(999)
+
+	for _, groupId := range []*int64{nil, &group, &other} {
+		if _, err := s.GetRelationshipStatus(123456, groupId); err != nil {
+			t.Fatalf("创建关系失败: %v", err)
+		}
+	}
+
+	// 只重置当前会话的关系
+	if err := s.ResetRelationship(123456, &group); err != nil {
+		t.Fatalf("重置群关系失败: %v", err)
+	}
+	var groups []int64
+	storage.GetDB().Model(&storage.UserRelationship{}).
+		Where("self_id = ? AND qq_id = ? AND group_id IS NOT NULL", 10001, 123456).Pluck("group_id", &groups)
+	if len(groups) != 1 || groups[0] != other {
+		t.Fatalf("重置群888后剩余群关系 %v, 期望只剩群999", groups)
+	}
+
+	if err := s.ResetRelationship(123456, nil); err != nil {
+		t.Fatalf("重置私聊关系失败: %v", err)
+	}
+	var count int64
+	storage.GetDB().Model(&storage.UserRelationship{}).Where("self_id = ? AND qq_id = ?", 10001, 123456).Count(&count)
+	if count != 1 {
+		t.Fatalf("重置私聊后剩余关系 %d 条, 期望只剩群999的 1 条", count)
+	}
+}
@@ -19,8 +19,18 @@ func InitDatabase(cfg *config.DatabaseConfig) error {
 		cfg.Host, cfg.User, cfg.Password, cfg.DBName, cfg.Port, cfg.SSLMode,
 	)
 
+	if err := Open(postgres.Open(dsn)); err != nil {
+		return err
+	}
+
+	utils.Info("数据库连接成功")
+	return nil
+}
+
+// Open 使用指定驱动打开数据库并迁移表结构（测试可传入其他驱动）
+func Open(dialector gorm.Dialector) error {
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	DB, err = gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent), // 静默模式，避免SQL日志干扰
 	})
 
@@ -28,15 +38,80 @@ func InitDatabase(cfg *config.DatabaseConfig) error {
 		return fmt.Errorf("连接数据库失败: %v", err)
 	}
 
+	// 关系表唯一索引已从qq_id、(self_id, qq_id)改为按私聊/群分别唯一，移除旧索引
+	for _, name := range []string{"idx_user_relationships_qq_id", "idx_rel_self_qq"} {
+		if DB.Migrator().HasIndex(&UserRelationship{}, name) {
+			if err := DB.Migrator().DropIndex(&UserRelationship{}, name); err != nil {
+				return fmt.Errorf("移除旧索引失败: %v", err)
+			}
+		}
+	}
+
+	// 发件箱message_id单列索引已由按会话查找的组合索引代替
+	if DB.Migrator().HasIndex(&OutboxMessage{}, "idx_outbox_messages_message_id") {
+		if err := DB.Migrator().DropIndex(&OutboxMessage{}, "idx_outbox_messages_message_id"); err != nil {
+			return fmt.Errorf("移除旧索引失败: %v", err)
+		}
+	}
+
 	// 自动迁移表结构
-	if err := DB.AutoMigrate(&ChatHistory{}, &UserRelationship{}); err != nil {
+	if err := DB.AutoMigrate(&ChatHistory{}, &UserRelationship{}, &OutboxMessage{}, &PluginState{}, &UserRole{}, &GroupPolicy{}); err != nil {
 		return fmt.Errorf("数据库迁移失败: %v", err)
 	}
-
-	utils.Info("数据库连接成功")
 	return nil
 }
 
+// BackfillSelfID 将多账号改造前的旧数据(self_id=0)归属到唯一配置的账号
+// 配置了多个账号时无法判断归属，只记录日志，这些数据不会再被读取
+func BackfillSelfID(selfIDs []int64) error {
+	var histories, relationships int64
+	if err := DB.Unscoped().Model(&ChatHistory{}).Where("self_id = 0").Count(&histories).Error; err != nil {
+		return fmt.Errorf("统计旧对话历史失败: %v", err)
+	}
+	if err := DB.Model(&UserRelationship{}).Where("self_id = 0").Count(&relationships).Error; err != nil {
+		return fmt.Errorf("统计旧关系数据失败: %v", err)
+	}
+	if histories == 0 && relationships == 0 {
+		return nil
+	}
+
+	if len(selfIDs) != 1 {
+		utils.Error("发现未归属账号的旧数据(对话历史%d条, 关系%d条)，配置了多个账号无法自动归属，这些数据将不可见", histories, relationships)
+		return nil
+	}
+	selfID := selfIDs[0]
+	if selfID == 0 {
+		// 未配置self_id时账号本身使用0，旧数据可以直接读取
+		return nil
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&ChatHistory{}).Where("self_id = 0").Update("self_id", selfID)
+		if result.Error != nil {
+			return fmt.Errorf("迁移旧对话历史失败: %v", result.Error)
+		}
+		movedHistories := result.RowsAffected
+
+		// 该账号下已有同一用户同一会话（私聊或同一个群）的关系时保留新数据，旧数据不再迁移
+		result = tx.Model(&UserRelationship{}).
+			Where("self_id = 0 AND NOT EXISTS (?)",
+				tx.Table("user_relationships AS cur").Select("1").
+					Where("cur.self_id = ? AND cur.qq_id = user_relationships.qq_id", selfID).
+					Where("COALESCE(cur.group_id, 0) = COALESCE(user_relationships.group_id, 0)")).
+			Update("self_id", selfID)
+		if result.Error != nil {
+			return fmt.Errorf("迁移旧关系数据失败: %v", result.Error)
+		}
+		movedRelationships := result.RowsAffected
+
+		utils.Info("旧数据已归属到账号 %d: 对话历史%d条, 关系%d条", selfID, movedHistories, movedRelationships)
+		if skipped := relationships - movedRelationships; skipped > 0 {
+			utils.Error("%d条旧关系数据与账号 %d 的现有关系冲突，未迁移", skipped, selfID)
+		}
+		return nil
+	})
+}
+
 // GetDB 获取数据库实例
 func GetDB() *gorm.DB {
 	return DB
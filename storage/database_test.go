@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+)
+
+func TestBackfillSelfIDRelationships(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)"
+	if err := Open(sqlite.Open(dsn)); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+
+	group := int64(888)
+	rows := []UserRelationship{
+		{SelfId: 0, QQId: 123456},                  // 旧私聊关系，账号下已有同一私聊关系
+		{SelfId: 0, QQId: 123456, GroupId: &group}, // 旧群关系，账号下没有
+		{SelfId: 10001, QQId: 123456},
+	}
+	if err := DB.Create(&rows).Error; err != nil {
+		t.Fatalf("写入关系失败: %v", err)
+	}
+
+	if err := BackfillSelfID([]int64{10001}); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+
+	var moved, kept int64
+	DB.Model(&UserRelationship{}).Where("self_id = ? AND group_id = ?", 10001, group).Count(&moved)
+	DB.Model(&UserRelationship{}).Where("self_id = 0 AND group_id IS NULL").Count(&kept)
+	if moved != 1 || kept != 1 {
+		t.Fatalf("迁移后群关系 %d 条, 未迁移的冲突私聊关系 %d 条, 期望各 1 条", moved, kept)
+	}
+}
@@ -2,19 +2,25 @@ package storage
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // 删除User表，不再需要用户注册系统
 
 // ChatHistory 对话历史表
 type ChatHistory struct {
-	ID        uint                   `gorm:"primaryKey" json:"id"`
-	QQId      int64                  `gorm:"index;not null" json:"qq_id"`       // QQ号
-	GroupId   *int64                 `gorm:"index" json:"group_id,omitempty"`   // 群号(可选)
-	Role      string                 `gorm:"size:20;not null" json:"role"`      // user/utils (支持工具调用)
-	Content   string                 `gorm:"type:text;not null" json:"content"` // 消息内容
-	Metadata  map[string]interface{} `gorm:"type:jsonb" json:"metadata"`        // 元数据字段
-	CreatedAt time.Time              `json:"created_at"`
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	SelfId     int64                  `gorm:"index;not null;default:0" json:"self_id"`       // 机器人QQ号（多账号区分）
+	QQId       int64                  `gorm:"index;not null" json:"qq_id"`                   // QQ号（对话对象，群聊中机器人的回复记为被回复的用户）
+	GroupId    *int64                 `gorm:"index" json:"group_id,omitempty"`               // 群号(可选)
+	SenderId   int64                  `gorm:"not null;default:0" json:"sender_id,omitempty"` // 发送者QQ号（群聊记录）
+	SenderName string                 `gorm:"size:64" json:"sender_name,omitempty"`          // 发送者昵称（群聊记录）
+	Role       string                 `gorm:"size:20;not null" json:"role"`                  // user/utils (支持工具调用)
+	Content    string                 `gorm:"type:text;not null" json:"content"`             // 消息内容
+	Metadata   map[string]interface{} `gorm:"type:jsonb;serializer:json" json:"metadata"`    // 元数据字段
+	CreatedAt  time.Time              `json:"created_at"`
+	DeletedAt  gorm.DeletedAt         `gorm:"index" json:"-"` // 软删除时间（全局清空后可撤销）
 }
 
 // TableName 指定表名
@@ -25,15 +31,16 @@ func (ChatHistory) TableName() string {
 // UserRelationship 用户关系状态表
 type UserRelationship struct {
 	ID                  uint      `gorm:"primaryKey" json:"id"`
-	QQId                int64     `gorm:"uniqueIndex;not null" json:"qq_id"`              // QQ号（唯一）
-	GroupId             *int64    `gorm:"index" json:"group_id,omitempty"`                // 群号(可选)
-	Stage               int       `gorm:"default:1;not null" json:"stage"`                // 关系阶段 1-4
-	Familiarity         float64   `gorm:"default:0;not null" json:"familiarity"`          // 熟悉度 0-100
-	Trust               float64   `gorm:"default:0;not null" json:"trust"`                // 信任度 0-100
-	Intimacy            float64   `gorm:"default:0;not null" json:"intimacy"`             // 亲密度 0-100
-	TotalMessages       int       `gorm:"default:0;not null" json:"total_messages"`       // 总消息数
-	AccumulatedCount    int       `gorm:"default:0;not null" json:"accumulated_count"`    // 累计对话次数（用于控制评估频率）
-	EvaluationThreshold int       `gorm:"default:1;not null" json:"evaluation_threshold"` // 评估阈值（累计N次后评估）
+	SelfId              int64     `gorm:"uniqueIndex:idx_rel_private,where:group_id IS NULL;uniqueIndex:idx_rel_group;not null;default:0" json:"self_id"` // 机器人QQ号（多账号区分）
+	QQId                int64     `gorm:"uniqueIndex:idx_rel_private,where:group_id IS NULL;uniqueIndex:idx_rel_group;not null" json:"qq_id"`             // QQ号（同一账号下私聊一条、每个群各一条）
+	GroupId             *int64    `gorm:"index;uniqueIndex:idx_rel_group" json:"group_id,omitempty"`                                                      // 群号(可选，为空表示私聊关系)
+	Stage               int       `gorm:"default:1;not null" json:"stage"`                                                                                // 关系阶段 1-4
+	Familiarity         float64   `gorm:"default:0;not null" json:"familiarity"`                                                                          // 熟悉度 0-100
+	Trust               float64   `gorm:"default:0;not null" json:"trust"`                                                                                // 信任度 0-100
+	Intimacy            float64   `gorm:"default:0;not null" json:"intimacy"`                                                                             // 亲密度 0-100
+	TotalMessages       int       `gorm:"default:0;not null" json:"total_messages"`                                                                       // 总消息数
+	AccumulatedCount    int       `gorm:"default:0;not null" json:"accumulated_count"`                                                                    // 累计对话次数（用于控制评估频率）
+	EvaluationThreshold int       `gorm:"default:1;not null" json:"evaluation_threshold"`                                                                 // 评估阈值（累计N次后评估）
 	UpdatedAt           time.Time `json:"updated_at"`
 	CreatedAt           time.Time `json:"created_at"`
 }
@@ -42,3 +49,73 @@ type UserRelationship struct {
 func (UserRelationship) TableName() string {
 	return "user_relationships"
 }
+
+// OutboxMessage 待发送消息表（发件箱）
+type OutboxMessage struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	SelfId     int64      `gorm:"index:idx_outbox_target;index:idx_outbox_message;not null" json:"self_id"`             // 机器人QQ号
+	TargetType string     `gorm:"index:idx_outbox_target;index:idx_outbox_message;size:10;not null" json:"target_type"` // private/group
+	TargetId   int64      `gorm:"index:idx_outbox_target;index:idx_outbox_message;not null" json:"target_id"`           // 用户QQ号或群号
+	Message    string     `gorm:"type:text;not null" json:"message"`                                                    // JSON编码的消息内容
+	Status     string     `gorm:"index;size:10;not null;default:pending" json:"status"`                                 // pending/sent/failed
+	Attempts   int        `gorm:"default:0;not null" json:"attempts"`                                                   // 已尝试次数
+	LastError  string     `gorm:"type:text" json:"last_error,omitempty"`                                                // 最后一次失败原因
+	MessageId  int32      `gorm:"index:idx_outbox_message" json:"message_id,omitempty"`                                 // 发送成功后的message_id（按会话查找机器人发出的消息）
+	SentAt     *time.Time `json:"sent_at,omitempty"`                                                                    // 发送成功时间
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// PluginState 插件启用状态表（按群或用户设置）
+type PluginState struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SelfId     int64     `gorm:"uniqueIndex:idx_plugin_scope;not null" json:"self_id"`             // 机器人QQ号
+	PluginName string    `gorm:"uniqueIndex:idx_plugin_scope;size:64;not null" json:"plugin_name"` // 插件名称
+	ScopeType  string    `gorm:"uniqueIndex:idx_plugin_scope;size:10;not null" json:"scope_type"`  // group/user
+	ScopeId    int64     `gorm:"uniqueIndex:idx_plugin_scope;not null" json:"scope_id"`            // 群号或QQ号
+	Enabled    bool      `gorm:"not null" json:"enabled"`                                          // 是否启用
+	UpdatedAt  time.Time `json:"updated_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PluginState) TableName() string {
+	return "plugin_states"
+}
+
+// UserRole 用户角色表（group_id为0表示全局角色）
+type UserRole struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SelfId    int64     `gorm:"uniqueIndex:idx_role_scope;not null" json:"self_id"`            // 机器人QQ号
+	QQId      int64     `gorm:"uniqueIndex:idx_role_scope;not null" json:"qq_id"`              // QQ号
+	GroupId   int64     `gorm:"uniqueIndex:idx_role_scope;not null;default:0" json:"group_id"` // 群号（0表示全局）
+	Role      string    `gorm:"size:10;not null" json:"role"`                                  // owner/admin/trusted/user/banned
+	GrantedBy int64     `json:"granted_by"`                                                    // 授权人QQ号
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserRole) TableName() string {
+	return "user_roles"
+}
+
+// GroupPolicy 群白名单/黑名单
+type GroupPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SelfId    int64     `gorm:"uniqueIndex:idx_group_policy;not null" json:"self_id"`  // 机器人QQ号
+	GroupId   int64     `gorm:"uniqueIndex:idx_group_policy;not null" json:"group_id"` // 群号
+	Mode      string    `gorm:"size:10;not null" json:"mode"`                          // allow/block
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (GroupPolicy) TableName() string {
+	return "group_policies"
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+type traceKey struct{}
+
+// ContextLogger 带追踪ID前缀的日志记录器
+type ContextLogger struct {
+	prefix string
+}
+
+// NewTraceID 生成追踪ID
+func NewTraceID() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%012x", GetTimeStamp())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// WithTrace 在上下文中设置追踪ID
+func WithTrace(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+// TraceID 获取上下文中的追踪ID
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// Log 获取上下文对应的日志记录器（日志带追踪ID前缀）
+func Log(ctx context.Context) *ContextLogger {
+	if id := TraceID(ctx); id != "" {
+		return &ContextLogger{prefix: "[" + id + "] "}
+	}
+	return &ContextLogger{}
+}
+
+// Info 信息日志
+func (l *ContextLogger) Info(format string, v ...interface{}) {
+	defaultLogger.infoLog.Output(2, l.prefix+fmt.Sprintf(format, v...))
+}
+
+// Error 错误日志
+func (l *ContextLogger) Error(format string, v ...interface{}) {
+	defaultLogger.errorLog.Output(2, l.prefix+fmt.Sprintf(format, v...))
+}
+
+// Debug 调试日志
+func (l *ContextLogger) Debug(format string, v ...interface{}) {
+	defaultLogger.debugLog.Output(2, l.prefix+fmt.Sprintf(format, v...))
+}